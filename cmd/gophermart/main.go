@@ -1,16 +1,110 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/ospiem/gophermart/internal/server"
+	"github.com/ospiem/gophermart"
+	"github.com/ospiem/gophermart/internal/config"
 	"github.com/rs/zerolog"
 )
 
+// timeoutShutdown is the share of the shutdown deadline for stopping the
+// servers, and again for closing the DB and flushing traces.
+const timeoutShutdown = 5 * time.Second
+
+var errUsage = errors.New("usage: gophermart config print [flags]")
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfig(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
-	if err := server.Run(logger); err != nil {
-		logger.Fatal().Err(err)
+	if err := run(logger); err != nil {
+		logger.Fatal().Err(err).Msg("failed to run the service")
 	}
 	logger.Info().Msg("Graceful shutdown completed successfully. All connections closed, and resources released.")
 }
+
+// runConfig prints the effective configuration with secrets redacted, then
+// fails if it does not validate.
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errUsage
+	}
+	cfg, err := config.Load(args[1:])
+	if err != nil {
+		return err
+	}
+	if err := cfg.Redacted().WriteYAML(os.Stdout); err != nil {
+		return err
+	}
+	return cfg.Validate()
+}
+
+// run serves until SIGINT or SIGTERM, reloading the configuration on SIGHUP.
+func run(logger zerolog.Logger) error {
+	cfg, err := config.New()
+	if err != nil {
+		return fmt.Errorf("cannot initialize config: %w", err)
+	}
+	srv, err := gophermart.New(gophermart.WithConfig(cfg), gophermart.WithLogger(logger))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancelCtx := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancelCtx()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	startErr := srv.Start(ctx)
+	if startErr == nil {
+		wait(ctx, srv, hup, logger)
+	}
+
+	// The shutdown phases run one after another, each with its own deadline.
+	deadline := cfg.ShutdownDrainDelay + timeoutShutdown + cfg.WorkerDrainTimeout + timeoutShutdown
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), deadline)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return errors.Join(startErr, fmt.Errorf("failed to gracefully shutdown the service: %w", err))
+	}
+	return startErr
+}
+
+// wait returns once ctx is done or a server fails. On SIGHUP it re-reads the
+// configuration and applies the settings that can change live.
+func wait(ctx context.Context, srv *gophermart.Server, hup <-chan os.Signal, l zerolog.Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-srv.Err():
+			l.Error().Err(err).Msg("server has failed")
+			return
+		case <-hup:
+		}
+
+		next, err := config.New()
+		if err != nil {
+			l.Error().Err(err).Msg("cannot reload config, keeping the current one")
+			continue
+		}
+		if rejected := srv.Reload(next); len(rejected) > 0 {
+			l.Warn().Strs("settings", rejected).Msg("settings cannot change without a restart, ignoring them")
+		}
+		l.Info().Msg("Config has been reloaded")
+	}
+}
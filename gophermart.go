@@ -0,0 +1,379 @@
+// Package gophermart runs the loyalty service. It lets another program embed
+// the service or start it from tests; cmd/gophermart is a thin wrapper around
+// it.
+package gophermart
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/config"
+	"github.com/ospiem/gophermart/internal/expiry"
+	"github.com/ospiem/gophermart/internal/health"
+	"github.com/ospiem/gophermart/internal/metrics"
+	"github.com/ospiem/gophermart/internal/models/fraud"
+	"github.com/ospiem/gophermart/internal/models/limit"
+	"github.com/ospiem/gophermart/internal/restclient"
+	"github.com/ospiem/gophermart/internal/storage/postgres"
+	"github.com/ospiem/gophermart/internal/tlsutil"
+	"github.com/ospiem/gophermart/internal/tools"
+	"github.com/ospiem/gophermart/internal/tracing"
+	api "github.com/ospiem/gophermart/internal/transport/http/v1"
+	"github.com/rs/zerolog"
+)
+
+// readHeaderTimeout bounds how long a client may take to send the headers.
+const readHeaderTimeout = 10 * time.Second
+
+// Config holds the service settings.
+type Config = config.Config
+
+// Storage is what the service needs from the storage.
+type Storage interface {
+	api.Storage
+	restclient.Storage
+	expiry.Storage
+}
+
+// The storage may also implement these to take part in health checks, admin
+// bootstrap and reloads.
+type (
+	pinger interface {
+		Ping(ctx context.Context) error
+	}
+	adminPromoter interface {
+		PromoteFirstAdmin(ctx context.Context, login string) (bool, error)
+	}
+	liveSettings interface {
+		SetWithdrawLimits(l limit.Limits)
+		SetFraudThresholds(t fraud.Thresholds)
+	}
+)
+
+// Server is the loyalty service: the HTTP API, the accrual workers and the
+// expirer.
+type Server struct {
+	// cfg is what the components were built with and never changes, while
+	// live follows Reload.
+	cfg  Config
+	live Config
+	mu   sync.Mutex
+
+	log     zerolog.Logger
+	storage Storage
+	db      *postgres.DB
+	metrics *metrics.Metrics
+	health  *health.Checker
+	api     *api.API
+	accrual *restclient.RestClient
+	handler http.Handler
+	servers []*http.Server
+	addr    net.Addr
+
+	errs            chan error
+	wg              sync.WaitGroup
+	stopWork        context.CancelFunc
+	shutdownTracing func(context.Context) error
+}
+
+// New builds the service. Unless WithStorage is given, it connects to the
+// PostgreSQL database of the configuration and migrates it.
+func New(opts ...Option) (*Server, error) {
+	o := options{logger: zerolog.Nop()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.cfg == nil {
+		cfg, err := config.Load(nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load config: %w", err)
+		}
+		o.cfg = &cfg
+	}
+	if err := validate(*o.cfg, o.storage != nil); err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		cfg:     *o.cfg,
+		live:    *o.cfg,
+		log:     o.logger.Hook(tracing.LogHook{}),
+		storage: o.storage,
+		health:  health.New(),
+		errs:    make(chan error, 2),
+	}
+	s.metrics = metrics.New(s.log)
+
+	if s.storage == nil {
+		db, err := postgres.NewDB(s.log.WithContext(context.Background()), s.cfg.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("cannot initialize PostgreSQL database: %w", err)
+		}
+		db.SetPointsExpiry(s.cfg.PointsExpiry)
+		db.SetReferralBonuses(float32(s.cfg.ReferrerBonus), float32(s.cfg.RefereeBonus))
+		db.SetTierRules(s.cfg.TierRules())
+		db.SetWithdrawLimits(s.cfg.WithdrawLimits())
+		db.SetFraudThresholds(s.cfg.FraudThresholds())
+		s.metrics.RegisterPool(db.Stat)
+		s.metrics.RegisterOrders(db.CountPendingOrders)
+		s.health.Add("postgres", db.Ping)
+		s.health.Add("migrations", db.CheckMigrations)
+		s.db = db
+		s.storage = db
+	} else if p, ok := s.storage.(pinger); ok {
+		s.health.Add("storage", p.Ping)
+	}
+
+	accrual, err := restclient.New(&s.cfg, s.storage, s.metrics, &s.log)
+	if err != nil {
+		s.closeDB()
+		return nil, fmt.Errorf("cannot initialize accrual client: %w", err)
+	}
+	if o.accrual != nil {
+		accrual.Client = o.accrual
+	}
+	s.accrual = accrual
+	s.health.Add("accrual", accrual.Ping)
+
+	s.api = api.New(&s.cfg, s.storage, s.metrics, s.health, &s.log)
+	r := s.api.Router(o.middlewares...)
+	for _, m := range o.mounts {
+		r.Mount(m.pattern, m.handler)
+	}
+	s.handler = r
+	return s, nil
+}
+
+// validate checks cfg. A storage given with WithStorage needs no database_uri.
+func validate(cfg Config, ownStorage bool) error {
+	err := cfg.Validate()
+	var verr config.ValidationError
+	if err == nil || !ownStorage || !errors.As(err, &verr) {
+		return err
+	}
+	var rest config.ValidationError
+	for _, fe := range verr {
+		if fe.Key != "database_uri" {
+			rest = append(rest, fe)
+		}
+	}
+	if len(rest) == 0 {
+		return nil
+	}
+	return rest
+}
+
+// Handler returns the API with the middlewares and mounts of the options.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Addr returns the address the API listens on once started, which tells the
+// port when the configured one is 0.
+func (s *Server) Addr() net.Addr {
+	return s.addr
+}
+
+// Err returns a channel that receives an error if a server stops serving
+// before Shutdown.
+func (s *Server) Err() <-chan error {
+	return s.errs
+}
+
+// Start sets up tracing, promotes the admin, starts listening and starts the
+// accrual workers and the expirer. ctx bounds the start only: the service runs
+// until Shutdown, which also releases what a failed Start has acquired.
+func (s *Server) Start(ctx context.Context) error {
+	shutdownTracing, err := tracing.Setup(ctx, s.cfg.TracingExporter, s.cfg.TracingEndpoint,
+		s.cfg.TracingSampleRatio)
+	if err != nil {
+		return fmt.Errorf("cannot initialize tracing: %w", err)
+	}
+	s.shutdownTracing = shutdownTracing
+
+	if s.cfg.AdminLogin != "" {
+		if err := s.promoteAdmin(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Background work keeps the values of ctx but not its cancellation.
+	workCtx, stopWork := context.WithCancel(context.WithoutCancel(ctx))
+	s.stopWork = stopWork
+
+	srv := &http.Server{Addr: s.cfg.Endpoint, Handler: s.handler, ReadHeaderTimeout: readHeaderTimeout}
+	if s.cfg.TLSCertFile != "" {
+		if srv.TLSConfig, err = s.serverTLS(workCtx); err != nil {
+			return err
+		}
+	}
+	s.log.Info().Msgf("Starting server on %s", s.cfg.Endpoint)
+	if s.addr, err = s.serve(srv); err != nil {
+		return err
+	}
+	// Metrics are unauthenticated, so they never share the public listener and
+	// stay off unless METRICS_ADDRESS is set.
+	if s.cfg.MetricsAddress != "" {
+		s.log.Info().Msgf("Serving metrics on %s", s.cfg.MetricsAddress)
+		_, err := s.serve(&http.Server{Addr: s.cfg.MetricsAddress, Handler: s.metrics.Handler(),
+			ReadHeaderTimeout: readHeaderTimeout})
+		if err != nil {
+			return err
+		}
+	}
+
+	// A Reload before Start has already changed the live settings, so the pool
+	// takes its size from them. Holding mu orders Start with a concurrent Reload.
+	s.mu.Lock()
+	s.accrual.Run(workCtx, &s.wg)
+	s.accrual.Resize(s.live.WorkersNum)
+	s.mu.Unlock()
+	expiry.New(&s.cfg, s.storage, &s.log).Run(workCtx, &s.wg)
+	return nil
+}
+
+// serve listens on the address of srv and serves it in the background, over
+// HTTPS if srv has TLS settings. It returns the address it listens on.
+func (s *Server) serve(srv *http.Server) (net.Addr, error) {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on %s: %w", srv.Addr, err)
+	}
+	s.servers = append(s.servers, srv)
+
+	go func() {
+		serve := srv.Serve
+		if srv.TLSConfig != nil {
+			serve = func(ln net.Listener) error { return srv.ServeTLS(ln, "", "") }
+		}
+		if err := serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.errs <- fmt.Errorf("listen and serve has failed: %w", err)
+		}
+	}()
+	return ln.Addr(), nil
+}
+
+// serverTLS loads the server certificate and keeps it up to date until ctx is
+// done.
+func (s *Server) serverTLS(ctx context.Context) (*tls.Config, error) {
+	version, err := tlsutil.ParseVersion(s.cfg.TLSMinVersion)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse TLS version: %w", err)
+	}
+	cert, err := tlsutil.LoadCertificate(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load server certificate: %w", err)
+	}
+	cert.Watch(ctx, &s.wg, &s.log)
+	return tlsutil.ServerConfig(cert, version), nil
+}
+
+// promoteAdmin bootstraps the first admin. The user must already be registered,
+// and nobody may have the admin role yet: a demoted admin is not promoted back.
+func (s *Server) promoteAdmin(ctx context.Context) error {
+	login := s.cfg.AdminLogin
+	ap, ok := s.storage.(adminPromoter)
+	if !ok {
+		s.log.Warn().Str("login", login).Msg("cannot promote admin: the storage cannot set roles")
+		return nil
+	}
+	promoted, err := ap.PromoteFirstAdmin(s.log.WithContext(ctx), login)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			s.log.Warn().Str("login", login).Msg("cannot promote admin: user is not registered")
+			return nil
+		}
+		return fmt.Errorf("cannot promote admin: %w", err)
+	}
+	if !promoted {
+		s.log.Info().Str("login", login).Msg("Admin already exists, the user keeps its role")
+		return nil
+	}
+	s.log.Info().Str("login", login).Msg("User has admin role")
+	return nil
+}
+
+// Reload applies the live settings of cfg and returns the keys of the other
+// settings that differ: those only change on restart. It may be called before
+// Start, which then starts with the reloaded settings.
+func (s *Server) Reload(cfg Config) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rejected []string
+	s.live, rejected = s.live.Reload(cfg)
+	tools.SetGlobalLogLevel(s.live.LogLevel)
+	s.accrual.Resize(s.live.WorkersNum)
+	s.accrual.SetPagination(s.live.Pagination)
+	if ls, ok := s.storage.(liveSettings); ok {
+		ls.SetWithdrawLimits(s.live.WithdrawLimits())
+		ls.SetFraudThresholds(s.live.FraudThresholds())
+	}
+	s.api.Reload(s.live)
+	return rejected
+}
+
+// Shutdown stops the service in phases: readiness fails for the drain delay,
+// the servers stop and finish the requests in flight, the accrual workers
+// finish their orders within the worker drain timeout, and then the database
+// is closed and traces are flushed. ctx bounds the whole shutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var errs []error
+
+	if len(s.servers) > 0 {
+		s.health.ShutDown()
+		s.log.Info().Msgf("Draining traffic for %s", s.cfg.ShutdownDrainDelay)
+		select {
+		case <-ctx.Done():
+		case <-time.After(s.cfg.ShutdownDrainDelay):
+		}
+		s.log.Info().Msg("Shutting down HTTP servers")
+		for _, srv := range s.servers {
+			if err := srv.Shutdown(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("an error occurred during server shutdown: %w", err))
+			}
+		}
+		s.log.Info().Msg("Servers have been shutdown")
+	}
+
+	if s.stopWork != nil {
+		s.log.Info().Msg("Stopping accrual workers and expirer")
+		s.stopWork()
+	}
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		// Requests and workers may use the DB until they are done.
+		s.closeDB()
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("background work has not stopped: %w", ctx.Err()))
+	}
+
+	if s.shutdownTracing != nil {
+		if err := s.shutdownTracing(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("cannot flush traces: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// closeDB closes the database if New opened it.
+func (s *Server) closeDB() {
+	if s.db == nil {
+		return
+	}
+	s.log.Info().Msg("Closing DB")
+	s.db.Close()
+	s.log.Info().Msg("DB has been closed")
+}
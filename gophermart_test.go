@@ -0,0 +1,192 @@
+package gophermart_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ospiem/gophermart"
+	"github.com/ospiem/gophermart/internal/config"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// idleStorage has nothing to process. The API methods the tests do not call
+// are left to the embedded nil interface.
+type idleStorage struct {
+	gophermart.Storage
+}
+
+func (idleStorage) SelectOrdersToProceed(context.Context, int, *int) ([]models.Order, error) {
+	time.Sleep(10 * time.Millisecond)
+	return nil, nil
+}
+func (idleStorage) ExpireLots(context.Context) (int, error)                   { return 0, nil }
+func (idleStorage) ExpireHolds(context.Context) (int, error)                  { return 0, nil }
+func (idleStorage) DeleteExpiredIdempotencyKeys(context.Context) (int, error) { return 0, nil }
+func (idleStorage) RecalculateTiers(context.Context) (int, error)             { return 0, nil }
+func (idleStorage) Ping(context.Context) error                                { return nil }
+
+func testConfig(t *testing.T, accrual string) gophermart.Config {
+	t.Helper()
+	cfg, err := config.Load(nil)
+	require.NoError(t, err)
+	cfg.Endpoint = "127.0.0.1:0"
+	cfg.MetricsAddress = "127.0.0.1:0"
+	cfg.AccrualSysAddress = accrual
+	cfg.JWTSecretKey = "secret"
+	cfg.LogLevel = "error"
+	cfg.ShutdownDrainDelay = 0
+	return cfg
+}
+
+func TestNewValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    func(cfg gophermart.Config) []gophermart.Option
+		wantErr bool
+	}{
+		{name: "custom storage needs no DSN", opts: func(cfg gophermart.Config) []gophermart.Option {
+			return []gophermart.Option{gophermart.WithConfig(cfg), gophermart.WithStorage(idleStorage{})}
+		}},
+		{name: "database needs DSN", wantErr: true, opts: func(cfg gophermart.Config) []gophermart.Option {
+			return []gophermart.Option{gophermart.WithConfig(cfg)}
+		}},
+		{name: "other settings are checked", wantErr: true, opts: func(cfg gophermart.Config) []gophermart.Option {
+			cfg.JWTSecretKey = ""
+			return []gophermart.Option{gophermart.WithConfig(cfg), gophermart.WithStorage(idleStorage{})}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, "http://localhost:8081")
+			cfg.DSN = ""
+			_, err := gophermart.New(tt.opts(cfg)...)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestServer(t *testing.T) {
+	accrual := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer accrual.Close()
+
+	srv, err := gophermart.New(
+		gophermart.WithConfig(testConfig(t, accrual.URL)),
+		gophermart.WithStorage(idleStorage{}),
+		gophermart.WithAccrualClient(accrual.Client()),
+		gophermart.WithMiddleware(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Embedded", "yes")
+				next.ServeHTTP(w, r)
+			})
+		}),
+		gophermart.WithMount("/embedded", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "mounted")
+		})),
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "mount", path: "/embedded", wantCode: http.StatusOK, wantBody: "mounted"},
+		{name: "liveness", path: "/healthz", wantCode: http.StatusOK},
+		{name: "api", path: "/api/user/orders", wantCode: http.StatusUnauthorized},
+		{name: "no public metrics", path: "/metrics", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, "yes", w.Header().Get("X-Embedded"))
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, srv.Start(ctx))
+	url := "http://" + srv.Addr().String() + "/readyz"
+
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.NoError(t, srv.Shutdown(ctx))
+	_, err = http.Get(url)
+	assert.Error(t, err, "the server must not accept requests after shutdown")
+}
+
+// queueStorage hands out a batch of orders once and then has nothing to process.
+type queueStorage struct {
+	idleStorage
+	once   sync.Once
+	orders []models.Order
+}
+
+func (s *queueStorage) SelectOrdersToProceed(ctx context.Context, n int, lastID *int) ([]models.Order, error) {
+	var orders []models.Order
+	s.once.Do(func() { orders = s.orders })
+	if orders != nil {
+		return orders, nil
+	}
+	return s.idleStorage.SelectOrdersToProceed(ctx, n, lastID)
+}
+
+func TestReloadBeforeStart(t *testing.T) {
+	arrived, release := make(chan struct{}, 3), make(chan struct{})
+	accrual := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer accrual.Close()
+	unblock := sync.OnceFunc(func() { close(release) })
+	defer unblock()
+
+	cfg := testConfig(t, accrual.URL)
+	cfg.WorkersNum = 1
+	s := &queueStorage{orders: []models.Order{{ID: "12345678903"}, {ID: "4561261212345467"}, {ID: "79927398713"}}}
+	srv, err := gophermart.New(
+		gophermart.WithConfig(cfg),
+		gophermart.WithStorage(s),
+		gophermart.WithAccrualClient(accrual.Client()),
+	)
+	require.NoError(t, err)
+
+	next := cfg
+	next.WorkersNum = 3
+	assert.Empty(t, srv.Reload(next))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, srv.Start(ctx))
+	for i := 0; i < 3; i++ {
+		select {
+		case <-arrived:
+		case <-ctx.Done():
+			t.Fatalf("only %d of 3 workers polled the accrual system", i)
+		}
+	}
+	unblock()
+	require.NoError(t, srv.Shutdown(ctx))
+}
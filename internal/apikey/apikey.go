@@ -0,0 +1,51 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Keys look like gm_<prefix>_<secret>. The prefix is stored in clear text to
+// find the key and to let users recognise it, the whole key only as a hash.
+const keyPrefix = "gm"
+const separator = "_"
+const prefixBytes = 4
+const secretBytes = 24
+const keyParts = 3
+
+var ErrMalformedKey = errors.New("malformed api key")
+
+func Generate() (key string, prefix string, err error) {
+	p := make([]byte, prefixBytes)
+	if _, err := rand.Read(p); err != nil {
+		return "", "", fmt.Errorf("cannot read random bytes: %w", err)
+	}
+	s := make([]byte, secretBytes)
+	if _, err := rand.Read(s); err != nil {
+		return "", "", fmt.Errorf("cannot read random bytes: %w", err)
+	}
+	prefix = hex.EncodeToString(p)
+	return strings.Join([]string{keyPrefix, prefix, hex.EncodeToString(s)}, separator), prefix, nil
+}
+
+func Prefix(key string) (string, error) {
+	parts := strings.Split(key, separator)
+	if len(parts) != keyParts || parts[0] != keyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", ErrMalformedKey
+	}
+	return parts[1], nil
+}
+
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func Verify(key string, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(key)), []byte(hash)) == 1
+}
@@ -0,0 +1,42 @@
+package apikey
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateAndVerify(t *testing.T) {
+	key, prefix, err := Generate()
+	require.NoError(t, err)
+
+	got, err := Prefix(key)
+	require.NoError(t, err)
+	assert.Equal(t, prefix, got)
+	assert.True(t, Verify(key, Hash(key)))
+	assert.False(t, Verify(key+"x", Hash(key)))
+}
+
+func TestPrefix(t *testing.T) {
+	testCases := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "valid", key: "gm_0a1b2c3d_secret", wantErr: false},
+		{name: "wrong prefix", key: "xx_0a1b2c3d_secret", wantErr: true},
+		{name: "no secret", key: "gm_0a1b2c3d_", wantErr: true},
+		{name: "jwt", key: "eyJhbGciOi.eyJMb2dpbiI6.sig", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Prefix(tc.key)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, ErrMalformedKey)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -3,52 +3,328 @@ package config
 import (
 	"flag"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/caarlos0/env/v9"
+	"github.com/ospiem/gophermart/internal/models/fraud"
+	"github.com/ospiem/gophermart/internal/models/limit"
+	"github.com/ospiem/gophermart/internal/models/tier"
 )
 
+const defaultLogLevel = "info"
 const defaultPagination = 10
 const defaultNumberOfWorkers = 3
+const defaultHashWorkers = 2
+const defaultHashQueueSize = 64
+const defaultResetTokenTTL = 15 * time.Minute
+const defaultResetNotifier = "log"
+const defaultResetNotifierFile = "reset_tokens.jsonl"
+const defaultReversalPolicy = "negative"
+const defaultPointsExpiry = 365 * 24 * time.Hour
+const defaultExpiryCheckInterval = time.Hour
+const defaultExpiringSoonWindow = 30 * 24 * time.Hour
+const defaultHoldTTL = 15 * time.Minute
+const defaultHoldCheckInterval = time.Minute
+const defaultIdempotencyTTL = 24 * time.Hour
+const defaultReferrerBonus = 100
+const defaultRefereeBonus = 50
+const defaultTierWindow = 365 * 24 * time.Hour
+const defaultSilverThreshold = 1000
+const defaultGoldThreshold = 5000
+const defaultSilverMultiplier = 1.1
+const defaultGoldMultiplier = 1.25
+const defaultApprovalTTL = 72 * time.Hour
+const defaultFraudWindow = time.Hour
+const defaultFraudInvalidNumber = 20
+const defaultFraudConflict = 5
+const defaultFraudAccrualInvalid = 5
+const defaultTracingExporter = "none"
+const defaultTracingSampleRatio = 1
+const defaultShutdownDrainDelay = 2 * time.Second
+const defaultTLSMinVersion = "1.2"
+const defaultWorkerDrainTimeout = 10 * time.Second
 
+// Config holds the service settings. Fields tagged reload:"live" may change
+// while the service runs, see Reload.
 type Config struct {
-	Endpoint          string `env:"RUN_ADDRESS"`
-	DSN               string `env:"DATABASE_URI"`
-	AccrualSysAddress string `env:"ACCRUAL_SYSTEM_ADDRESS"`
-	LogLevel          string `env:"LOG_LEVEL"`
-	JWTSecretKey      string `env:"SECRET_KEY"`
-	Pagination        int    `env:"DB_PAGINATION"`
-	WorkersNum        int    `env:"WORKERS_NUMBER"`
+	ConfigFile          string        `env:"CONFIG_FILE" yaml:"-"`
+	Endpoint            string        `env:"RUN_ADDRESS" yaml:"run_address"`
+	DSN                 string        `env:"DATABASE_URI" yaml:"database_uri"`
+	AccrualSysAddress   string        `env:"ACCRUAL_SYSTEM_ADDRESS" yaml:"accrual_system_address"`
+	LogLevel            string        `env:"LOG_LEVEL" yaml:"log_level" reload:"live"`
+	JWTSecretKey        string        `env:"SECRET_KEY" yaml:"secret_key"`
+	Pagination          int           `env:"DB_PAGINATION" yaml:"db_pagination" reload:"live"`
+	WorkersNum          int           `env:"WORKERS_NUMBER" yaml:"workers_number" reload:"live"`
+	HashWorkers         int           `env:"HASH_WORKERS" yaml:"hash_workers"`
+	HashQueueSize       int           `env:"HASH_QUEUE_SIZE" yaml:"hash_queue_size"`
+	ResetNotifier       string        `env:"RESET_NOTIFIER" yaml:"reset_notifier"`
+	ResetNotifierFile   string        `env:"RESET_NOTIFIER_FILE" yaml:"reset_notifier_file"`
+	ResetTokenTTL       time.Duration `env:"RESET_TOKEN_TTL" yaml:"reset_token_ttl"`
+	AdminLogin          string        `env:"ADMIN_LOGIN" yaml:"admin_login"`
+	ReversalPolicy      string        `env:"REVERSAL_POLICY" yaml:"reversal_policy"`
+	PointsExpiry        time.Duration `env:"POINTS_EXPIRY" yaml:"points_expiry"`
+	ExpiryCheckInterval time.Duration `env:"EXPIRY_CHECK_INTERVAL" yaml:"expiry_check_interval"`
+	ExpiringSoonWindow  time.Duration `env:"EXPIRING_SOON_WINDOW" yaml:"expiring_soon_window"`
+	HoldTTL             time.Duration `env:"HOLD_TTL" yaml:"hold_ttl"`
+	HoldCheckInterval   time.Duration `env:"HOLD_CHECK_INTERVAL" yaml:"hold_check_interval"`
+	IdempotencyTTL      time.Duration `env:"IDEMPOTENCY_TTL" yaml:"idempotency_ttl"`
+	TransferDailyLimit  float64       `env:"TRANSFER_DAILY_LIMIT" yaml:"transfer_daily_limit" reload:"live"`
+	ReferrerBonus       float64       `env:"REFERRER_BONUS" yaml:"referrer_bonus"`
+	RefereeBonus        float64       `env:"REFEREE_BONUS" yaml:"referee_bonus"`
+	TierWindow          time.Duration `env:"TIER_WINDOW" yaml:"tier_window"`
+	SilverThreshold     float64       `env:"TIER_SILVER_THRESHOLD" yaml:"tier_silver_threshold"`
+	GoldThreshold       float64       `env:"TIER_GOLD_THRESHOLD" yaml:"tier_gold_threshold"`
+	SilverMultiplier    float64       `env:"TIER_SILVER_MULTIPLIER" yaml:"tier_silver_multiplier"`
+	GoldMultiplier      float64       `env:"TIER_GOLD_MULTIPLIER" yaml:"tier_gold_multiplier"`
+	BronzeWithdrawLimit float64       `env:"TIER_BRONZE_WITHDRAW_LIMIT" yaml:"tier_bronze_withdraw_limit"`
+	SilverWithdrawLimit float64       `env:"TIER_SILVER_WITHDRAW_LIMIT" yaml:"tier_silver_withdraw_limit"`
+	GoldWithdrawLimit   float64       `env:"TIER_GOLD_WITHDRAW_LIMIT" yaml:"tier_gold_withdraw_limit"`
+	WithdrawMax         float64       `env:"WITHDRAW_MAX" yaml:"withdraw_max" reload:"live"`
+	WithdrawDailyLimit  float64       `env:"WITHDRAW_DAILY_LIMIT" yaml:"withdraw_daily_limit" reload:"live"`
+	WithdrawMonthLimit  float64       `env:"WITHDRAW_MONTHLY_LIMIT" yaml:"withdraw_monthly_limit" reload:"live"`
+	WithdrawDailyCount  int           `env:"WITHDRAW_DAILY_COUNT" yaml:"withdraw_daily_count" reload:"live"`
+	WithdrawMinBalance  float64       `env:"WITHDRAW_MIN_BALANCE" yaml:"withdraw_min_balance" reload:"live"`
+	ApprovalThreshold   float64       `env:"WITHDRAW_APPROVAL_THRESHOLD" yaml:"withdraw_approval_threshold" reload:"live"`
+	ApprovalTTL         time.Duration `env:"WITHDRAW_APPROVAL_TTL" yaml:"withdraw_approval_ttl"`
+	FraudWindow         time.Duration `env:"FRAUD_WINDOW" yaml:"fraud_window" reload:"live"`
+	FraudInvalidNumber  int           `env:"FRAUD_INVALID_NUMBER" yaml:"fraud_invalid_number" reload:"live"`
+	FraudConflict       int           `env:"FRAUD_CONFLICT" yaml:"fraud_conflict" reload:"live"`
+	FraudAccrualInvalid int           `env:"FRAUD_ACCRUAL_INVALID" yaml:"fraud_accrual_invalid" reload:"live"`
+	MetricsAddress      string        `env:"METRICS_ADDRESS" yaml:"metrics_address"`
+	TracingExporter     string        `env:"TRACING_EXPORTER" yaml:"tracing_exporter"`
+	TracingEndpoint     string        `env:"TRACING_ENDPOINT" yaml:"tracing_endpoint"`
+	TracingSampleRatio  float64       `env:"TRACING_SAMPLE_RATIO" yaml:"tracing_sample_ratio"`
+	ShutdownDrainDelay  time.Duration `env:"SHUTDOWN_DRAIN_DELAY" yaml:"shutdown_drain_delay"`
+	WorkerDrainTimeout  time.Duration `env:"WORKER_DRAIN_TIMEOUT" yaml:"worker_drain_timeout"`
+	TLSCertFile         string        `env:"TLS_CERT_FILE" yaml:"tls_cert_file"`
+	TLSKeyFile          string        `env:"TLS_KEY_FILE" yaml:"tls_key_file"`
+	TLSMinVersion       string        `env:"TLS_MIN_VERSION" yaml:"tls_min_version"`
+	AccrualCertFile     string        `env:"ACCRUAL_TLS_CERT_FILE" yaml:"accrual_tls_cert_file"`
+	AccrualKeyFile      string        `env:"ACCRUAL_TLS_KEY_FILE" yaml:"accrual_tls_key_file"`
+	AccrualCAFile       string        `env:"ACCRUAL_TLS_CA_FILE" yaml:"accrual_tls_ca_file"`
+	AccrualTLSVersion   string        `env:"ACCRUAL_TLS_MIN_VERSION" yaml:"accrual_tls_min_version"`
 }
 
+// New loads the configuration from the command line arguments and validates it.
 func New() (Config, error) {
-	var c Config
-	err := env.Parse(&c)
+	c, err := Load(os.Args[1:])
 	if err != nil {
+		return Config{}, err
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// Load builds the configuration from, in increasing precedence, the defaults,
+// the configuration file, the environment and the flags in args. The file is
+// given by the -config flag or the CONFIG_FILE variable. The result is not
+// validated.
+func Load(args []string) (Config, error) {
+	c := defaults()
+	fs := flag.NewFlagSet("gophermart", flag.ContinueOnError)
+	registerFlags(fs, &c)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, fmt.Errorf("cannot parse flags: %w", err)
+	}
+
+	// Flags win over the file and the environment, so they are put aside and
+	// applied again once those are loaded.
+	flags := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+	c = defaults()
+
+	path := os.Getenv("CONFIG_FILE")
+	if v, ok := flags["config"]; ok {
+		path = v
+	}
+	if path != "" {
+		if err := loadFile(path, &c); err != nil {
+			return Config{}, err
+		}
+	}
+	if err := env.Parse(&c); err != nil {
 		return Config{}, fmt.Errorf("cannot parse environment variables: %w", err)
 	}
-	parseFlag(&c)
+	for name, v := range flags {
+		if err := fs.Set(name, v); err != nil {
+			return Config{}, fmt.Errorf("cannot set flag %s: %w", name, err)
+		}
+	}
+	c.ConfigFile = path
 	return c, nil
 }
 
-func parseFlag(c *Config) {
-	var ep, dsn, accrualEp string
-	flag.StringVar(&ep, "a", "", "set service endpoint")
-	flag.StringVar(&dsn, "d", "", "set DSN endpoint")
-	flag.StringVar(&accrualEp, "r", "", "set accrual system endpoint")
-	flag.StringVar(&c.LogLevel, "l", "info", "set log level")
-	flag.IntVar(&c.Pagination, "pagination", defaultPagination, "set pagination for DB pagination")
-	flag.IntVar(&c.WorkersNum, "w", defaultNumberOfWorkers, "set number of workers")
+func defaults() Config {
+	return Config{
+		LogLevel:            defaultLogLevel,
+		Pagination:          defaultPagination,
+		WorkersNum:          defaultNumberOfWorkers,
+		HashWorkers:         defaultHashWorkers,
+		HashQueueSize:       defaultHashQueueSize,
+		ResetNotifier:       defaultResetNotifier,
+		ResetNotifierFile:   defaultResetNotifierFile,
+		ResetTokenTTL:       defaultResetTokenTTL,
+		ReversalPolicy:      defaultReversalPolicy,
+		PointsExpiry:        defaultPointsExpiry,
+		ExpiryCheckInterval: defaultExpiryCheckInterval,
+		ExpiringSoonWindow:  defaultExpiringSoonWindow,
+		HoldTTL:             defaultHoldTTL,
+		HoldCheckInterval:   defaultHoldCheckInterval,
+		IdempotencyTTL:      defaultIdempotencyTTL,
+		ReferrerBonus:       defaultReferrerBonus,
+		RefereeBonus:        defaultRefereeBonus,
+		TierWindow:          defaultTierWindow,
+		SilverThreshold:     defaultSilverThreshold,
+		GoldThreshold:       defaultGoldThreshold,
+		SilverMultiplier:    defaultSilverMultiplier,
+		GoldMultiplier:      defaultGoldMultiplier,
+		ApprovalTTL:         defaultApprovalTTL,
+		FraudWindow:         defaultFraudWindow,
+		FraudInvalidNumber:  defaultFraudInvalidNumber,
+		FraudConflict:       defaultFraudConflict,
+		FraudAccrualInvalid: defaultFraudAccrualInvalid,
+		TracingExporter:     defaultTracingExporter,
+		TracingSampleRatio:  defaultTracingSampleRatio,
+		ShutdownDrainDelay:  defaultShutdownDrainDelay,
+		WorkerDrainTimeout:  defaultWorkerDrainTimeout,
+		TLSMinVersion:       defaultTLSMinVersion,
+		AccrualTLSVersion:   defaultTLSMinVersion,
+	}
+}
 
-	flag.Parse()
+func registerFlags(fs *flag.FlagSet, c *Config) {
+	fs.StringVar(&c.ConfigFile, "config", c.ConfigFile, "set the YAML or TOML configuration file")
+	fs.StringVar(&c.Endpoint, "a", c.Endpoint, "set service endpoint")
+	fs.StringVar(&c.DSN, "d", c.DSN, "set DSN endpoint")
+	fs.StringVar(&c.AccrualSysAddress, "r", c.AccrualSysAddress, "set accrual system endpoint")
+	fs.StringVar(&c.LogLevel, "l", c.LogLevel, "set log level")
+	fs.IntVar(&c.Pagination, "pagination", c.Pagination, "set pagination for DB pagination")
+	fs.IntVar(&c.WorkersNum, "w", c.WorkersNum, "set number of workers")
+	fs.IntVar(&c.HashWorkers, "hash-workers", c.HashWorkers, "set number of password hashing workers")
+	fs.IntVar(&c.HashQueueSize, "hash-queue", c.HashQueueSize, "set password hashing queue size")
+	fs.StringVar(&c.ResetNotifier, "reset-notifier", c.ResetNotifier, "set password reset notifier (log or file)")
+	fs.StringVar(&c.ResetNotifierFile, "reset-notifier-file", c.ResetNotifierFile,
+		"set file for the file password reset notifier")
+	fs.DurationVar(&c.ResetTokenTTL, "reset-token-ttl", c.ResetTokenTTL, "set password reset token lifetime")
+	fs.StringVar(&c.AdminLogin, "admin", c.AdminLogin, "promote an existing user to admin on startup if there is no admin yet")
+	fs.StringVar(&c.ReversalPolicy, "reversal-policy", c.ReversalPolicy,
+		"set how reversals debit spent points (negative, partial or block)")
+	fs.DurationVar(&c.PointsExpiry, "points-expiry", c.PointsExpiry, "set points lifetime, 0 disables expiry")
+	fs.DurationVar(&c.ExpiryCheckInterval, "expiry-interval", c.ExpiryCheckInterval,
+		"set how often expired points, idempotency keys and tiers are checked")
+	fs.DurationVar(&c.ExpiringSoonWindow, "expiring-soon", c.ExpiringSoonWindow,
+		"set the window for the expiring soon balance figure")
+	fs.DurationVar(&c.IdempotencyTTL, "idempotency-ttl", c.IdempotencyTTL,
+		"set how long responses to requests with an Idempotency-Key are kept")
+	fs.DurationVar(&c.HoldTTL, "hold-ttl", c.HoldTTL, "set how long withdrawal holds live before they are released")
+	fs.DurationVar(&c.HoldCheckInterval, "hold-interval", c.HoldCheckInterval,
+		"set how often expired withdrawal holds are released")
+	fs.Float64Var(&c.TransferDailyLimit, "transfer-daily-limit", c.TransferDailyLimit,
+		"set how many points a user may transfer per day, 0 disables the limit")
+	fs.Float64Var(&c.ReferrerBonus, "referrer-bonus", c.ReferrerBonus,
+		"set points credited to the referrer after the referee's first processed order")
+	fs.Float64Var(&c.RefereeBonus, "referee-bonus", c.RefereeBonus,
+		"set points credited to the referee after their first processed order")
+	fs.DurationVar(&c.TierWindow, "tier-window", c.TierWindow, "set the rolling window for lifetime accrual of tiers")
+	fs.Float64Var(&c.SilverThreshold, "tier-silver-threshold", c.SilverThreshold,
+		"set lifetime accrual needed for the silver tier")
+	fs.Float64Var(&c.GoldThreshold, "tier-gold-threshold", c.GoldThreshold,
+		"set lifetime accrual needed for the gold tier")
+	fs.Float64Var(&c.SilverMultiplier, "tier-silver-multiplier", c.SilverMultiplier,
+		"set accrual multiplier of the silver tier")
+	fs.Float64Var(&c.GoldMultiplier, "tier-gold-multiplier", c.GoldMultiplier,
+		"set accrual multiplier of the gold tier")
+	fs.Float64Var(&c.BronzeWithdrawLimit, "tier-bronze-withdraw-limit", c.BronzeWithdrawLimit,
+		"set daily withdraw limit of the bronze tier, 0 disables the limit")
+	fs.Float64Var(&c.SilverWithdrawLimit, "tier-silver-withdraw-limit", c.SilverWithdrawLimit,
+		"set daily withdraw limit of the silver tier, 0 disables the limit")
+	fs.Float64Var(&c.GoldWithdrawLimit, "tier-gold-withdraw-limit", c.GoldWithdrawLimit,
+		"set daily withdraw limit of the gold tier, 0 disables the limit")
+	fs.Float64Var(&c.WithdrawMax, "withdraw-max", c.WithdrawMax,
+		"set the largest single withdrawal, 0 disables the limit")
+	fs.Float64Var(&c.WithdrawDailyLimit, "withdraw-daily-limit", c.WithdrawDailyLimit,
+		"set points a user may withdraw per day, 0 disables the limit")
+	fs.Float64Var(&c.WithdrawMonthLimit, "withdraw-monthly-limit", c.WithdrawMonthLimit,
+		"set points a user may withdraw per month, 0 disables the limit")
+	fs.IntVar(&c.WithdrawDailyCount, "withdraw-daily-count", c.WithdrawDailyCount,
+		"set how many withdrawals a user may make per day, 0 disables the limit")
+	fs.Float64Var(&c.WithdrawMinBalance, "withdraw-min-balance", c.WithdrawMinBalance,
+		"set the balance a withdrawal must leave, 0 disables the limit")
+	fs.Float64Var(&c.ApprovalThreshold, "withdraw-approval-threshold", c.ApprovalThreshold,
+		"set the withdrawal size that needs admin approval, 0 disables approvals")
+	fs.DurationVar(&c.ApprovalTTL, "withdraw-approval-ttl", c.ApprovalTTL,
+		"set how long a withdrawal waits for approval before it is released")
+	fs.DurationVar(&c.FraudWindow, "fraud-window", c.FraudWindow, "set the window fraud signals are counted in")
+	fs.IntVar(&c.FraudInvalidNumber, "fraud-invalid-number", c.FraudInvalidNumber,
+		"set how many uploads failing the Luhn check flag a user, 0 ignores them")
+	fs.IntVar(&c.FraudConflict, "fraud-conflict", c.FraudConflict,
+		"set how many uploads of other users' orders flag a user, 0 ignores them")
+	fs.IntVar(&c.FraudAccrualInvalid, "fraud-accrual-invalid", c.FraudAccrualInvalid,
+		"set how many orders rejected by the accrual system flag a user, 0 ignores them")
+	fs.StringVar(&c.MetricsAddress, "metrics-address", c.MetricsAddress,
+		"serve /metrics on its own address, e.g. localhost:9464; never on the public endpoint, disabled when empty")
+	fs.StringVar(&c.TracingExporter, "tracing-exporter", c.TracingExporter,
+		"set the trace exporter (none, stdout or otlp)")
+	fs.StringVar(&c.TracingEndpoint, "tracing-endpoint", c.TracingEndpoint,
+		"set the OTLP/HTTP endpoint URL, empty uses the OTEL_EXPORTER_OTLP_* variables")
+	fs.Float64Var(&c.TracingSampleRatio, "tracing-sample-ratio", c.TracingSampleRatio,
+		"set the share of new traces that are sampled")
+	fs.DurationVar(&c.ShutdownDrainDelay, "shutdown-drain-delay", c.ShutdownDrainDelay,
+		"set how long readiness fails before the listener closes on shutdown")
+	fs.DurationVar(&c.WorkerDrainTimeout, "worker-drain-timeout", c.WorkerDrainTimeout,
+		"set how long accrual workers may finish in-flight orders on shutdown")
+	fs.StringVar(&c.TLSCertFile, "tls-cert", c.TLSCertFile, "set the server certificate file, enables HTTPS")
+	fs.StringVar(&c.TLSKeyFile, "tls-key", c.TLSKeyFile, "set the server private key file")
+	fs.StringVar(&c.TLSMinVersion, "tls-min-version", c.TLSMinVersion, "set the lowest TLS version the server accepts")
+	fs.StringVar(&c.AccrualCertFile, "accrual-tls-cert", c.AccrualCertFile,
+		"set the client certificate file for the accrual system")
+	fs.StringVar(&c.AccrualKeyFile, "accrual-tls-key", c.AccrualKeyFile,
+		"set the client private key file for the accrual system")
+	fs.StringVar(&c.AccrualCAFile, "accrual-tls-ca", c.AccrualCAFile,
+		"set the CA bundle the accrual system certificate is checked against")
+	fs.StringVar(&c.AccrualTLSVersion, "accrual-tls-min-version", c.AccrualTLSVersion,
+		"set the lowest TLS version used with the accrual system")
+}
 
-	if ep != "" {
-		c.Endpoint = ep
+// TierRules builds the loyalty tier rules from the configuration.
+func (c Config) TierRules() tier.Rules {
+	return tier.Rules{
+		Window: c.TierWindow,
+		Levels: []tier.Level{
+			{Name: tier.Bronze, Perks: tier.Perks{
+				Multiplier: 1, DailyWithdrawLimit: float32(c.BronzeWithdrawLimit)}},
+			{Name: tier.Silver, Threshold: float32(c.SilverThreshold), Perks: tier.Perks{
+				Multiplier: float32(c.SilverMultiplier), DailyWithdrawLimit: float32(c.SilverWithdrawLimit)}},
+			{Name: tier.Gold, Threshold: float32(c.GoldThreshold), Perks: tier.Perks{
+				Multiplier: float32(c.GoldMultiplier), DailyWithdrawLimit: float32(c.GoldWithdrawLimit)}},
+		},
 	}
-	if dsn != "" {
-		c.DSN = dsn
+}
+
+// WithdrawLimits builds the withdrawal limits from the configuration. The tier
+// limit is filled in per user.
+func (c Config) WithdrawLimits() limit.Limits {
+	return limit.Limits{
+		PerTransaction: float32(c.WithdrawMax),
+		Daily:          float32(c.WithdrawDailyLimit),
+		Monthly:        float32(c.WithdrawMonthLimit),
+		MinBalance:     float32(c.WithdrawMinBalance),
+		DailyCount:     c.WithdrawDailyCount,
 	}
-	if accrualEp != "" {
-		c.AccrualSysAddress = accrualEp
+}
+
+// FraudThresholds builds the fraud scoring thresholds from the configuration.
+func (c Config) FraudThresholds() fraud.Thresholds {
+	return fraud.Thresholds{
+		Window:         c.FraudWindow,
+		InvalidNumber:  c.FraudInvalidNumber,
+		Conflict:       c.FraudConflict,
+		AccrualInvalid: c.FraudAccrualInvalid,
 	}
 }
 
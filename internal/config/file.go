@@ -0,0 +1,112 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "REDACTED"
+
+var ErrUnknownFormat = errors.New("unknown configuration file format, want .yaml, .yml or .toml")
+
+// dsnPassword matches the password of a key/value DSN.
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('[^']*'|\S+)`)
+
+// loadFile reads the YAML or TOML file at path over c. Keys are the lower case
+// names of the environment variables; unknown keys are an error, so that typos
+// do not go unnoticed. Durations are strings such as "15m".
+func loadFile(path string, c *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read configuration file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	case ".toml":
+		// TOML goes through YAML, so that the struct needs a single set of keys.
+		var m map[string]any
+		if _, err := toml.Decode(string(data), &m); err != nil {
+			return fmt.Errorf("cannot parse %s: %w", path, err)
+		}
+		if data, err = yaml.Marshal(m); err != nil {
+			return fmt.Errorf("cannot convert %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownFormat, path)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration that is safe to show: the JWT
+// secret and the passwords of the database and the trace collector are masked.
+func (c Config) Redacted() Config {
+	if c.JWTSecretKey != "" {
+		c.JWTSecretKey = redacted
+	}
+	c.DSN = redactDSN(c.DSN)
+	c.TracingEndpoint = redactEndpoint(c.TracingEndpoint)
+	return c
+}
+
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		return redactPassword(u).String()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "${1}"+redacted)
+}
+
+// redactEndpoint masks the password of an endpoint given either as a URL or
+// as host:port with optional userinfo.
+func redactEndpoint(endpoint string) string {
+	if !strings.Contains(endpoint, "@") {
+		return endpoint
+	}
+	if strings.Contains(endpoint, "://") {
+		if u, err := url.Parse(endpoint); err == nil {
+			return redactPassword(u).String()
+		}
+		return redacted
+	}
+	u, err := url.Parse("//" + endpoint)
+	if err != nil {
+		return redacted
+	}
+	return strings.TrimPrefix(redactPassword(u).String(), "//")
+}
+
+func redactPassword(u *url.URL) *url.URL {
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u
+}
+
+// WriteYAML writes the configuration in the format of the configuration file.
+func (c Config) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return fmt.Errorf("cannot encode configuration: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("cannot encode configuration: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Reload returns c with the live settings of next applied. The keys of the
+// other settings that differ in next are returned as rejected: they only take
+// effect after a restart.
+func (c Config) Reload(next Config) (Config, []string) {
+	var rejected []string
+	cur := reflect.ValueOf(&c).Elem()
+	nv := reflect.ValueOf(next)
+	t := cur.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if reflect.DeepEqual(cur.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+		if f.Tag.Get("reload") == "live" {
+			cur.Field(i).Set(nv.Field(i))
+			continue
+		}
+		rejected = append(rejected, key(f))
+	}
+	return c, rejected
+}
+
+// key returns the configuration file key of the field, or its name for fields
+// that are not read from the file.
+func key(f reflect.StructField) string {
+	k, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if k == "" || k == "-" {
+		return f.Name
+	}
+	return k
+}
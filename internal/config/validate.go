@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ospiem/gophermart/internal/models/reversal"
+	"github.com/ospiem/gophermart/internal/notifier"
+	"github.com/ospiem/gophermart/internal/tlsutil"
+	"github.com/ospiem/gophermart/internal/tracing"
+	"github.com/rs/zerolog"
+)
+
+// FieldError describes an invalid setting by its configuration file key.
+type FieldError struct {
+	Key     string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Message)
+}
+
+// ValidationError lists every invalid setting, so that they can all be fixed
+// in one go.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Error())
+	}
+	return "invalid configuration: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks the settings and returns a ValidationError listing those that
+// are wrong.
+func (c Config) Validate() error {
+	var errs ValidationError
+	check := func(ok bool, key string, format string, args ...any) {
+		if !ok {
+			errs = append(errs, FieldError{Key: key, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	check(c.DSN != "", "database_uri", "must be set")
+	check(c.JWTSecretKey != "", "secret_key", "must be set")
+	check(isHTTPURL(c.AccrualSysAddress), "accrual_system_address", "must be an http or https URL, got %q",
+		c.AccrualSysAddress)
+	_, err := zerolog.ParseLevel(c.LogLevel)
+	check(err == nil, "log_level", "unknown level %q", c.LogLevel)
+
+	check(c.Pagination > 0, "db_pagination", "must be positive")
+	check(c.WorkersNum > 0, "workers_number", "must be positive")
+	check(c.HashWorkers > 0, "hash_workers", "must be positive")
+	check(c.HashQueueSize >= 0, "hash_queue_size", "must not be negative")
+
+	check(c.ResetNotifier == notifier.Log || c.ResetNotifier == notifier.File, "reset_notifier",
+		"must be %s or %s, got %q", notifier.Log, notifier.File, c.ResetNotifier)
+	check(c.ResetNotifier != notifier.File || c.ResetNotifierFile != "", "reset_notifier_file",
+		"must be set for the %s notifier", notifier.File)
+	check(reversal.IsValid(c.ReversalPolicy), "reversal_policy", "must be %s, %s or %s, got %q",
+		reversal.Negative, reversal.Partial, reversal.Block, c.ReversalPolicy)
+
+	check(c.ResetTokenTTL > 0, "reset_token_ttl", "must be positive")
+	check(c.PointsExpiry >= 0, "points_expiry", "must not be negative")
+	check(c.ExpiryCheckInterval > 0, "expiry_check_interval", "must be positive")
+	check(c.ExpiringSoonWindow >= 0, "expiring_soon_window", "must not be negative")
+	check(c.HoldTTL > 0, "hold_ttl", "must be positive")
+	check(c.HoldCheckInterval > 0, "hold_check_interval", "must be positive")
+	check(c.IdempotencyTTL > 0, "idempotency_ttl", "must be positive")
+	check(c.ApprovalTTL > 0, "withdraw_approval_ttl", "must be positive")
+	check(c.TierWindow > 0, "tier_window", "must be positive")
+	check(c.FraudWindow > 0, "fraud_window", "must be positive")
+	check(c.ShutdownDrainDelay >= 0, "shutdown_drain_delay", "must not be negative")
+	check(c.WorkerDrainTimeout > 0, "worker_drain_timeout", "must be positive")
+
+	// Slices rather than maps keep the errors in a stable order.
+	for _, f := range []struct {
+		key string
+		v   float64
+	}{
+		{"transfer_daily_limit", c.TransferDailyLimit},
+		{"referrer_bonus", c.ReferrerBonus},
+		{"referee_bonus", c.RefereeBonus},
+		{"tier_silver_threshold", c.SilverThreshold},
+		{"tier_bronze_withdraw_limit", c.BronzeWithdrawLimit},
+		{"tier_silver_withdraw_limit", c.SilverWithdrawLimit},
+		{"tier_gold_withdraw_limit", c.GoldWithdrawLimit},
+		{"withdraw_max", c.WithdrawMax},
+		{"withdraw_daily_limit", c.WithdrawDailyLimit},
+		{"withdraw_monthly_limit", c.WithdrawMonthLimit},
+		{"withdraw_min_balance", c.WithdrawMinBalance},
+		{"withdraw_approval_threshold", c.ApprovalThreshold},
+	} {
+		check(f.v >= 0, f.key, "must not be negative")
+	}
+	for _, f := range []struct {
+		key string
+		v   int
+	}{
+		{"withdraw_daily_count", c.WithdrawDailyCount},
+		{"fraud_invalid_number", c.FraudInvalidNumber},
+		{"fraud_conflict", c.FraudConflict},
+		{"fraud_accrual_invalid", c.FraudAccrualInvalid},
+	} {
+		check(f.v >= 0, f.key, "must not be negative")
+	}
+	check(c.GoldThreshold >= c.SilverThreshold, "tier_gold_threshold", "must not be below tier_silver_threshold")
+	check(c.SilverMultiplier >= 1, "tier_silver_multiplier", "must be at least 1")
+	check(c.GoldMultiplier >= 1, "tier_gold_multiplier", "must be at least 1")
+
+	check(c.TracingExporter == "" || c.TracingExporter == tracing.ExporterNone ||
+		c.TracingExporter == tracing.ExporterStdout || c.TracingExporter == tracing.ExporterOTLP,
+		"tracing_exporter", "must be %s, %s or %s, got %q",
+		tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP, c.TracingExporter)
+	check(c.TracingSampleRatio >= 0 && c.TracingSampleRatio <= 1, "tracing_sample_ratio", "must be within [0, 1]")
+
+	check((c.TLSCertFile == "") == (c.TLSKeyFile == ""), "tls_key_file", "must be set together with tls_cert_file")
+	_, err = tlsutil.ParseVersion(c.TLSMinVersion)
+	check(err == nil, "tls_min_version", "must be 1.0, 1.1, 1.2 or 1.3, got %q", c.TLSMinVersion)
+	check((c.AccrualCertFile == "") == (c.AccrualKeyFile == ""), "accrual_tls_key_file",
+		"must be set together with accrual_tls_cert_file")
+	check(c.AccrualCertFile == "" && c.AccrualCAFile == "" || strings.HasPrefix(c.AccrualSysAddress, "https:"),
+		"accrual_system_address", "must be an https URL when accrual TLS files are set")
+	_, err = tlsutil.ParseVersion(c.AccrualTLSVersion)
+	check(err == nil, "accrual_tls_min_version", "must be 1.0, 1.1, 1.2 or 1.3, got %q", c.AccrualTLSVersion)
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
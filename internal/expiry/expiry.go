@@ -0,0 +1,90 @@
+package expiry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ospiem/gophermart/internal/config"
+	"github.com/rs/zerolog"
+)
+
+type Storage interface {
+	ExpireLots(ctx context.Context) (int, error)
+	ExpireHolds(ctx context.Context) (int, error)
+	DeleteExpiredIdempotencyKeys(ctx context.Context) (int, error)
+	RecalculateTiers(ctx context.Context) (int, error)
+}
+
+// Expirer periodically debits point lots that have outlived their expiry date,
+// releases abandoned withdrawal holds, forgets expired idempotency keys and
+// downgrades tiers whose accruals have left the rolling window.
+type Expirer struct {
+	Storage Storage
+	Logger  *zerolog.Logger
+	Cfg     *config.Config
+}
+
+func New(cfg *config.Config, s Storage, l *zerolog.Logger) *Expirer {
+	return &Expirer{
+		Storage: s,
+		Logger:  l,
+		Cfg:     cfg,
+	}
+}
+
+// Run releases holds every HoldCheckInterval and runs the other jobs every
+// ExpiryCheckInterval, so that abandoned holds do not keep points for long.
+func (e *Expirer) Run(ctx context.Context, wg *sync.WaitGroup) {
+	logger := e.Logger.With().Str("func", "Expirer").Logger()
+	ctx = logger.WithContext(ctx)
+
+	e.every(ctx, wg, logger, e.Cfg.ExpiryCheckInterval, func() {
+		if e.Cfg.PointsExpiry > 0 {
+			e.expire(ctx, logger, "point lots", e.Storage.ExpireLots)
+		}
+		e.expire(ctx, logger, "idempotency keys", e.Storage.DeleteExpiredIdempotencyKeys)
+		e.expire(ctx, logger, "tiers", e.Storage.RecalculateTiers)
+	})
+	e.every(ctx, wg, logger, e.Cfg.HoldCheckInterval, func() {
+		e.expire(ctx, logger, "holds", e.Storage.ExpireHolds)
+	})
+}
+
+// every runs jobs right away and then every interval until ctx is done.
+func (e *Expirer) every(ctx context.Context, wg *sync.WaitGroup, logger zerolog.Logger, interval time.Duration,
+	jobs func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			jobs()
+
+			select {
+			case <-ctx.Done():
+				logger.Info().Dur("interval", interval).Msg("Stopped expirer")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// expire runs batches until nothing is overdue.
+func (e *Expirer) expire(ctx context.Context, logger zerolog.Logger, what string,
+	batch func(ctx context.Context) (int, error)) {
+	for ctx.Err() == nil {
+		n, err := batch(ctx)
+		if err != nil {
+			logger.Error().Err(err).Msgf("cannot expire %s", what)
+			return
+		}
+		if n == 0 {
+			return
+		}
+		logger.Info().Msgf("Expired %d batch entries of %s", n, what)
+	}
+}
@@ -0,0 +1,76 @@
+package expiry
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ospiem/gophermart/internal/config"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStorage counts the batches of every job and has nothing overdue.
+type countingStorage struct {
+	calls map[string]int
+	ran   chan string
+	mu    sync.Mutex
+}
+
+func (s *countingStorage) count(job string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[job]++
+	s.ran <- job
+	return 0, nil
+}
+
+func (s *countingStorage) ExpireLots(context.Context) (int, error)  { return s.count("lots") }
+func (s *countingStorage) ExpireHolds(context.Context) (int, error) { return s.count("holds") }
+func (s *countingStorage) DeleteExpiredIdempotencyKeys(context.Context) (int, error) {
+	return s.count("idempotency keys")
+}
+
+func (s *countingStorage) RecalculateTiers(context.Context) (int, error) { return s.count("tiers") }
+
+func TestRunPointsExpiry(t *testing.T) {
+	tests := []struct {
+		name     string
+		expiry   time.Duration
+		wantLots int
+	}{
+		{name: "disabled", expiry: 0, wantLots: 0},
+		{name: "enabled", expiry: 24 * time.Hour, wantLots: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &countingStorage{calls: make(map[string]int), ran: make(chan string, 4)}
+			cfg := &config.Config{PointsExpiry: tt.expiry, ExpiryCheckInterval: time.Hour,
+				HoldCheckInterval: time.Hour}
+			l := zerolog.Nop()
+			ctx, cancel := context.WithCancel(context.Background())
+			wg := &sync.WaitGroup{}
+			New(cfg, s, &l).Run(ctx, wg)
+
+			// Tiers are the last job of their round and holds run on their own.
+			for seen := map[string]bool{}; !seen["tiers"] || !seen["holds"]; {
+				select {
+				case job := <-s.ran:
+					seen[job] = true
+				case <-time.After(5 * time.Second):
+					t.Fatal("the expirer did not run")
+				}
+			}
+			cancel()
+			wg.Wait()
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			assert.Equal(t, tt.wantLots, s.calls["lots"])
+			require.Equal(t, 1, s.calls["holds"], "the other jobs run regardless of points expiry")
+			assert.Equal(t, 1, s.calls["tiers"])
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package hasher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ospiem/gophermart/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrQueueFull = errors.New("hashing queue is full")
+var ErrMismatch = errors.New("hash and password mismatch")
+
+// Pool bounds the number of concurrent bcrypt operations so that a burst of
+// logins cannot take every CPU core away from the rest of the API.
+type Pool struct {
+	workers chan struct{}
+	queue   chan struct{}
+	cost    int
+}
+
+// New creates a pool running at most workers bcrypt operations at once and
+// holding at most queueSize callers waiting for a free worker.
+func New(workers int, queueSize int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	return &Pool{
+		workers: make(chan struct{}, workers),
+		queue:   make(chan struct{}, workers+queueSize),
+		cost:    bcrypt.DefaultCost,
+	}
+}
+
+func (p *Pool) Hash(ctx context.Context, pass string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "bcrypt.Hash")
+	defer func() { tracing.End(span, err) }()
+
+	var hash []byte
+	err = p.do(ctx, func() error {
+		var err error
+		hash, err = bcrypt.GenerateFromPassword([]byte(pass), p.cost)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot generate hash: %w", err)
+	}
+	return string(hash), nil
+}
+
+func (p *Pool) Compare(ctx context.Context, hash string, pass string) (err error) {
+	ctx, span := tracing.Start(ctx, "bcrypt.Compare")
+	defer func() {
+		// A wrong password is an outcome, not a failure of the span.
+		if errors.Is(err, ErrMismatch) {
+			span.End()
+			return
+		}
+		tracing.End(span, err)
+	}()
+
+	err = p.do(ctx, func() error {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass))
+	})
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrMismatch
+		}
+		return fmt.Errorf("cannot compare passwords: %w", err)
+	}
+	return nil
+}
+
+// do reserves a place in the queue without blocking, then waits for a free
+// worker until ctx is done.
+func (p *Pool) do(ctx context.Context, fn func() error) error {
+	select {
+	case p.queue <- struct{}{}:
+	default:
+		return ErrQueueFull
+	}
+	defer func() { <-p.queue }()
+
+	select {
+	case p.workers <- struct{}{}:
+		trace.SpanFromContext(ctx).AddEvent("worker acquired")
+	case <-ctx.Done():
+		return fmt.Errorf("cannot wait for a free worker: %w", ctx.Err())
+	}
+	defer func() { <-p.workers }()
+
+	return fn()
+}
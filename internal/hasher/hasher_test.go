@@ -0,0 +1,37 @@
+package hasher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool_HashAndCompare(t *testing.T) {
+	p := New(1, 0)
+	ctx := context.Background()
+
+	hash, err := p.Hash(ctx, "qwerty")
+	require.NoError(t, err)
+	assert.NoError(t, p.Compare(ctx, hash, "qwerty"))
+	assert.ErrorIs(t, p.Compare(ctx, hash, "wrong"), ErrMismatch)
+}
+
+func TestPool_QueueFull(t *testing.T) {
+	p := New(1, 0)
+	p.queue <- struct{}{}
+
+	_, err := p.Hash(context.Background(), "qwerty")
+	assert.ErrorIs(t, err, ErrQueueFull)
+}
+
+func TestPool_ContextCanceled(t *testing.T) {
+	p := New(1, 1)
+	p.workers <- struct{}{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := p.Hash(ctx, "qwerty")
+	assert.ErrorIs(t, err, context.Canceled)
+}
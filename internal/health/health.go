@@ -0,0 +1,128 @@
+// Package health serves the liveness and readiness probes of the service.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// checkTimeout bounds every readiness check, so that a hung dependency fails
+// the probe instead of hanging it.
+const checkTimeout = 2 * time.Second
+
+var ErrShuttingDown = errors.New("the service is shutting down")
+
+// Check reports whether a dependency is usable.
+type Check func(ctx context.Context) error
+
+// Component is the state of a dependency. The probes are public, so Err, which
+// may name hosts and ports, is logged but never served.
+type Component struct {
+	Err    error  `json:"-"`
+	Status string `json:"status"`
+}
+
+type Report struct {
+	Status     string               `json:"status"`
+	Components map[string]Component `json:"components,omitempty"`
+}
+
+// Checker runs the readiness checks of the registered components. It is not
+// ready once shutdown has started, whatever the components say.
+type Checker struct {
+	mu           sync.RWMutex
+	checks       map[string]Check
+	shuttingDown atomic.Bool
+}
+
+func New() *Checker {
+	return &Checker{checks: make(map[string]Check)}
+}
+
+// Add registers a readiness check of the named component.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// ShutDown makes readiness fail from now on, so that load balancers stop
+// sending traffic before the listener closes.
+func (c *Checker) ShutDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Status runs every check concurrently and reports the state of each component.
+func (c *Checker) Status(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	rep := Report{Status: StatusOK, Components: make(map[string]Component, len(c.checks)+1)}
+	set := func(name string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			rep.Status = StatusFail
+			rep.Components[name] = Component{Status: StatusFail, Err: err}
+			return
+		}
+		rep.Components[name] = Component{Status: StatusOK}
+	}
+
+	if c.shuttingDown.Load() {
+		set("shutdown", ErrShuttingDown)
+	}
+	for name, check := range c.checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			set(name, check(ctx))
+		}(name, check)
+	}
+	wg.Wait()
+	return rep
+}
+
+// Live answers the liveness probe: the process serves HTTP, nothing more.
+func (c *Checker) Live(w http.ResponseWriter, _ *http.Request) {
+	writeReport(w, Report{Status: StatusOK})
+}
+
+// Ready answers the readiness probe with 503 if any component is not ready.
+// Only the status of each component is served, the errors go to the log.
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request) {
+	rep := c.Status(r.Context())
+	logger := zerolog.Ctx(r.Context())
+	for name, comp := range rep.Components {
+		if comp.Err != nil && !errors.Is(comp.Err, ErrShuttingDown) {
+			logger.Warn().Err(comp.Err).Str("component", name).Msg("component is not ready")
+		}
+	}
+	writeReport(w, rep)
+}
+
+func writeReport(w http.ResponseWriter, rep Report) {
+	w.Header().Set("Content-Type", "application/json")
+	if rep.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	// Probes only look at the status code, so a failed write is not worth logging.
+	_ = json.NewEncoder(w).Encode(rep)
+}
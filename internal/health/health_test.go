@@ -0,0 +1,71 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReady(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	failing := func(context.Context) error { return errors.New("connection refused") }
+
+	testCases := []struct {
+		name         string
+		checks       map[string]Check
+		shuttingDown bool
+		wantCode     int
+		wantFailed   []string
+	}{
+		{name: "all ready", checks: map[string]Check{"postgres": ok, "accrual": ok}, wantCode: http.StatusOK},
+		{name: "component down", checks: map[string]Check{"postgres": ok, "accrual": failing},
+			wantCode: http.StatusServiceUnavailable, wantFailed: []string{"accrual"}},
+		{name: "shutting down", checks: map[string]Check{"postgres": ok}, shuttingDown: true,
+			wantCode: http.StatusServiceUnavailable, wantFailed: []string{"shutdown"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := New()
+			for name, check := range tc.checks {
+				c.Add(name, check)
+			}
+			if tc.shuttingDown {
+				c.ShutDown()
+			}
+
+			rec := httptest.NewRecorder()
+			c.Ready(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, tc.wantCode, rec.Code)
+
+			assert.NotContains(t, rec.Body.String(), "connection refused", "errors must not be served")
+			var rep Report
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&rep))
+			var failed []string
+			for name, comp := range rep.Components {
+				if comp.Status == StatusFail {
+					failed = append(failed, name)
+				}
+			}
+			assert.ElementsMatch(t, tc.wantFailed, failed)
+			for _, name := range failed {
+				assert.Error(t, c.Status(context.Background()).Components[name].Err, "the error is kept for the log")
+			}
+		})
+	}
+}
+
+func TestLive(t *testing.T) {
+	c := New()
+	c.Add("postgres", func(context.Context) error { return errors.New("down") })
+	c.ShutDown()
+
+	rec := httptest.NewRecorder()
+	c.Live(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,253 @@
+// Package metrics exposes Prometheus metrics of the API, the database pool,
+// the accrual workers and the loyalty business. A nil *Metrics is valid and
+// records nothing, so components work without metrics.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog"
+)
+
+const namespace = "gophermart"
+
+// collectTimeout bounds the database queries made on a scrape.
+const collectTimeout = 2 * time.Second
+
+// unmatchedRoute labels requests that matched no route, so that random paths
+// cannot blow up the label cardinality.
+const unmatchedRoute = "unmatched"
+
+type Metrics struct {
+	registry        *prometheus.Registry
+	log             zerolog.Logger
+	httpRequests    *prometheus.CounterVec
+	httpDuration    *prometheus.HistogramVec
+	accrualRequests *prometheus.CounterVec
+	pointsAccrued   prometheus.Counter
+	pointsWithdrawn prometheus.Counter
+}
+
+func New(l zerolog.Logger) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		log:      l,
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests by method, chi route pattern and status code.",
+		}, []string{"method", "route", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency by method and chi route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		accrualRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "accrual",
+			Name:      "requests_total",
+			Help:      "Calls to the accrual system by response status code, or error if there was no response.",
+		}, []string{"code"}),
+		pointsAccrued: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "points_accrued_total",
+			Help:      "Points accrued by processed orders, without bonuses.",
+		}),
+		pointsWithdrawn: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "points_withdrawn_total",
+			Help:      "Points withdrawn by users.",
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.accrualRequests,
+		m.pointsAccrued,
+		m.pointsWithdrawn,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts requests and observes their latency per chi route pattern.
+// It must wrap the router so that the pattern is known once the request is served.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+		m.httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(code)).Inc()
+		m.httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// AccrualResponse counts a call to the accrual system that got a response.
+func (m *Metrics) AccrualResponse(code int) {
+	if m == nil {
+		return
+	}
+	m.accrualRequests.WithLabelValues(strconv.Itoa(code)).Inc()
+}
+
+// AccrualError counts a call to the accrual system that got no response.
+func (m *Metrics) AccrualError() {
+	if m == nil {
+		return
+	}
+	m.accrualRequests.WithLabelValues("error").Inc()
+}
+
+func (m *Metrics) PointsAccrued(points float32) {
+	if m == nil {
+		return
+	}
+	m.pointsAccrued.Add(float64(points))
+}
+
+func (m *Metrics) PointsWithdrawn(points float32) {
+	if m == nil {
+		return
+	}
+	m.pointsWithdrawn.Add(float64(points))
+}
+
+// RegisterQueue exposes the depth of a worker queue.
+func (m *Metrics) RegisterQueue(name string, depth func() int) {
+	if m == nil {
+		return
+	}
+	m.register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   "worker",
+		Name:        "queue_depth",
+		Help:        "Jobs waiting in a worker queue.",
+		ConstLabels: prometheus.Labels{"queue": name},
+	}, func() float64 { return float64(depth()) }))
+}
+
+// RegisterPool exposes the statistics of a pgx pool.
+func (m *Metrics) RegisterPool(stat func() *pgxpool.Stat) {
+	if m == nil {
+		return
+	}
+	m.register(&poolCollector{stat: stat})
+}
+
+// RegisterOrders exposes the number of orders by status. count is called on
+// every scrape.
+func (m *Metrics) RegisterOrders(count func(ctx context.Context) (map[string]int, error)) {
+	if m == nil {
+		return
+	}
+	m.register(&ordersCollector{count: count, log: m.log})
+}
+
+func (m *Metrics) register(c prometheus.Collector) {
+	if err := m.registry.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			m.log.Error().Err(err).Msg("cannot register metrics collector")
+		}
+	}
+}
+
+var (
+	poolAcquiredDesc = prometheus.NewDesc(namespace+"_db_pool_acquired_conns",
+		"Connections currently in use.", nil, nil)
+	poolIdleDesc = prometheus.NewDesc(namespace+"_db_pool_idle_conns",
+		"Idle connections.", nil, nil)
+	poolTotalDesc = prometheus.NewDesc(namespace+"_db_pool_total_conns",
+		"Open connections.", nil, nil)
+	poolMaxDesc = prometheus.NewDesc(namespace+"_db_pool_max_conns",
+		"Maximum size of the pool.", nil, nil)
+	poolAcquireCountDesc = prometheus.NewDesc(namespace+"_db_pool_acquires_total",
+		"Successful connection acquires.", nil, nil)
+	poolAcquireDurationDesc = prometheus.NewDesc(namespace+"_db_pool_acquire_duration_seconds_total",
+		"Time spent acquiring connections.", nil, nil)
+	poolEmptyAcquireDesc = prometheus.NewDesc(namespace+"_db_pool_empty_acquires_total",
+		"Acquires that had to wait for a connection.", nil, nil)
+	poolCanceledAcquireDesc = prometheus.NewDesc(namespace+"_db_pool_canceled_acquires_total",
+		"Acquires canceled by their context.", nil, nil)
+	ordersDesc = prometheus.NewDesc(namespace+"_orders",
+		"Orders by status.", []string{"status"}, nil)
+)
+
+type poolCollector struct {
+	stat func() *pgxpool.Stat
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{poolAcquiredDesc, poolIdleDesc, poolTotalDesc, poolMaxDesc,
+		poolAcquireCountDesc, poolAcquireDurationDesc, poolEmptyAcquireDesc, poolCanceledAcquireDesc} {
+		ch <- d
+	}
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquiredDesc, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleDesc, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalDesc, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxDesc, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireCountDesc, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireDurationDesc, prometheus.CounterValue,
+		s.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquireDesc, prometheus.CounterValue,
+		float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolCanceledAcquireDesc, prometheus.CounterValue,
+		float64(s.CanceledAcquireCount()))
+}
+
+type ordersCollector struct {
+	count func(ctx context.Context) (map[string]int, error)
+	log   zerolog.Logger
+}
+
+func (c *ordersCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ordersDesc
+}
+
+func (c *ordersCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+	counts, err := c.count(ctx)
+	if err != nil {
+		c.log.Error().Err(err).Msg("cannot count orders for metrics")
+		return
+	}
+	for s, n := range counts {
+		ch <- prometheus.MustNewConstMetric(ordersDesc, prometheus.GaugeValue, float64(n), s)
+	}
+}
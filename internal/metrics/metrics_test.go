@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareLabelsRoutePattern(t *testing.T) {
+	m := New(zerolog.Nop())
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Get("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	testCases := []struct {
+		name  string
+		path  string
+		route string
+		code  string
+	}{
+		{name: "route pattern", path: "/orders/1", route: "/orders/{id}", code: "404"},
+		{name: "same pattern", path: "/orders/2", route: "/orders/{id}", code: "404"},
+		{name: "unmatched", path: "/unknown", route: unmatchedRoute, code: "404"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+		})
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", "/orders/{id}", "404")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", unmatchedRoute, "404")))
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.AccrualError()
+	m.AccrualResponse(http.StatusOK)
+	m.PointsAccrued(1)
+	m.PointsWithdrawn(1)
+	m.RegisterQueue("orders", func() int { return 0 })
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	assert.NotNil(t, m.Middleware(next))
+}
+
+func TestHandlerExposesCounters(t *testing.T) {
+	m := New(zerolog.Nop())
+	m.AccrualResponse(http.StatusTooManyRequests)
+	m.PointsAccrued(12.5)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	assert.True(t, strings.Contains(body, `gophermart_accrual_requests_total{code="429"} 1`))
+	assert.True(t, strings.Contains(body, "gophermart_points_accrued_total 12.5"))
+}
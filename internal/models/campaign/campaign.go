@@ -0,0 +1,55 @@
+package campaign
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/tier"
+)
+
+var (
+	ErrNoName      = errors.New("campaign name is required")
+	ErrWindow      = errors.New("campaign must end after it starts")
+	ErrMultiplier  = errors.New("multiplier must be at least 1")
+	ErrFlatBonus   = errors.New("flat bonus must not be negative")
+	ErrNoReward    = errors.New("campaign must have a multiplier above 1 or a flat bonus")
+	ErrOrderPrefix = errors.New("order prefix must contain digits only")
+	ErrTier        = errors.New("unknown tier")
+)
+
+// Validate checks a campaign before it is stored. A zero multiplier is treated as 1.
+func Validate(c models.Campaign) error {
+	if strings.TrimSpace(c.Name) == "" {
+		return ErrNoName
+	}
+	if !c.EndsAt.After(c.StartsAt) {
+		return ErrWindow
+	}
+	if c.Multiplier != 0 && c.Multiplier < 1 {
+		return ErrMultiplier
+	}
+	if c.FlatBonus < 0 {
+		return ErrFlatBonus
+	}
+	if c.Multiplier <= 1 && c.FlatBonus == 0 {
+		return ErrNoReward
+	}
+	if c.Tier != "" && !tier.IsValid(c.Tier) {
+		return ErrTier
+	}
+	for _, r := range c.OrderPrefix {
+		if r < '0' || r > '9' {
+			return ErrOrderPrefix
+		}
+	}
+	return nil
+}
+
+// Bonus returns the points a campaign adds on top of the base accrual.
+func Bonus(base float32, multiplier float32, flat float32) float32 {
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	return base*(multiplier-1) + flat
+}
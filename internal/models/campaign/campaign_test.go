@@ -0,0 +1,44 @@
+package campaign
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/tier"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	valid := models.Campaign{Name: "Double points", StartsAt: start, EndsAt: start.Add(48 * time.Hour), Multiplier: 2}
+	testCases := []struct {
+		name   string
+		modify func(c *models.Campaign)
+		want   error
+	}{
+		{name: "valid", modify: func(c *models.Campaign) {}},
+		{name: "flat bonus only", modify: func(c *models.Campaign) { c.Multiplier, c.FlatBonus = 0, 10 }},
+		{name: "no name", modify: func(c *models.Campaign) { c.Name = " " }, want: ErrNoName},
+		{name: "ends before start", modify: func(c *models.Campaign) { c.EndsAt = start }, want: ErrWindow},
+		{name: "multiplier below one", modify: func(c *models.Campaign) { c.Multiplier = 0.5 }, want: ErrMultiplier},
+		{name: "negative flat", modify: func(c *models.Campaign) { c.FlatBonus = -1 }, want: ErrFlatBonus},
+		{name: "no reward", modify: func(c *models.Campaign) { c.Multiplier = 1 }, want: ErrNoReward},
+		{name: "tier", modify: func(c *models.Campaign) { c.Tier = tier.Gold }},
+		{name: "unknown tier", modify: func(c *models.Campaign) { c.Tier = "PLATINUM" }, want: ErrTier},
+		{name: "bad prefix", modify: func(c *models.Campaign) { c.OrderPrefix = "12%" }, want: ErrOrderPrefix},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := valid
+			tc.modify(&c)
+			assert.ErrorIs(t, Validate(c), tc.want)
+		})
+	}
+}
+
+func TestBonus(t *testing.T) {
+	assert.Equal(t, float32(100), Bonus(100, 2, 0))
+	assert.Equal(t, float32(60), Bonus(100, 1.5, 10))
+	assert.Equal(t, float32(10), Bonus(100, 0, 10))
+}
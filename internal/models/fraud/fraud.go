@@ -0,0 +1,53 @@
+package fraud
+
+import (
+	"fmt"
+	"time"
+)
+
+// Signal is a suspicious outcome of an order upload.
+type Signal = string
+
+const (
+	// InvalidNumber is an upload that fails the Luhn check.
+	InvalidNumber = "INVALID_NUMBER"
+	// Conflict is an upload of a number that belongs to another user.
+	Conflict = "CONFLICT"
+	// AccrualInvalid is an order the accrual system rejected as INVALID.
+	AccrualInvalid = "ACCRUAL_INVALID"
+)
+
+// Thresholds flag a user once any signal count within Window reaches its
+// threshold. A zero threshold ignores the signal.
+type Thresholds struct {
+	Window         time.Duration
+	InvalidNumber  int
+	Conflict       int
+	AccrualInvalid int
+}
+
+// Counts are the signals of a user within the window.
+type Counts struct {
+	InvalidNumber  int `json:"invalid_number"`
+	Conflict       int `json:"conflict"`
+	AccrualInvalid int `json:"accrual_invalid"`
+}
+
+// Evaluate returns why the counts are suspicious, or nothing if they are not.
+func Evaluate(t Thresholds, c Counts) []string {
+	var reasons []string
+	for _, s := range []struct {
+		signal    Signal
+		count     int
+		threshold int
+	}{
+		{InvalidNumber, c.InvalidNumber, t.InvalidNumber},
+		{Conflict, c.Conflict, t.Conflict},
+		{AccrualInvalid, c.AccrualInvalid, t.AccrualInvalid},
+	} {
+		if s.threshold > 0 && s.count >= s.threshold {
+			reasons = append(reasons, fmt.Sprintf("%d %s uploads within %s", s.count, s.signal, t.Window))
+		}
+	}
+	return reasons
+}
@@ -0,0 +1,30 @@
+package fraud
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluate(t *testing.T) {
+	th := Thresholds{Window: time.Hour, InvalidNumber: 10, Conflict: 3}
+	testCases := []struct {
+		name   string
+		counts Counts
+		want   []string
+	}{
+		{name: "clean", counts: Counts{InvalidNumber: 2, Conflict: 1}},
+		{name: "conflicts", counts: Counts{Conflict: 3}, want: []string{"3 CONFLICT uploads within 1h0m0s"}},
+		{name: "ignored signal", counts: Counts{AccrualInvalid: 100}},
+		{name: "several", counts: Counts{InvalidNumber: 12, Conflict: 5}, want: []string{
+			"12 INVALID_NUMBER uploads within 1h0m0s",
+			"5 CONFLICT uploads within 1h0m0s",
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Evaluate(th, tc.counts))
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package history
+
+type Kind = string
+
+const (
+	Accrual    = "ACCRUAL"
+	Withdrawal = "WITHDRAWAL"
+	Adjustment = "ADJUSTMENT"
+	Reversal   = "REVERSAL"
+	Expiry     = "EXPIRY"
+	// Hold reserves points for a pending withdrawal, HoldRelease returns them.
+	Hold        = "HOLD"
+	HoldRelease = "HOLD_RELEASE"
+	TransferIn  = "TRANSFER_IN"
+	TransferOut = "TRANSFER_OUT"
+	// ReferralBonus is paid to both sides once a referee's first order is processed.
+	ReferralBonus = "REFERRAL_BONUS"
+	// CampaignBonus is the part of an order's credit added by promotional campaigns.
+	CampaignBonus = "CAMPAIGN_BONUS"
+	// TierBonus is the part of an order's credit added by the loyalty tier multiplier.
+	TierBonus = "TIER_BONUS"
+	// DebtRepayment is the part of an accrual that went to repay a reversal debt.
+	DebtRepayment = "DEBT_REPAYMENT"
+)
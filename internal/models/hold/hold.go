@@ -0,0 +1,13 @@
+package hold
+
+type Status = string
+
+const (
+	HELD      = "HELD"
+	CONFIRMED = "CONFIRMED"
+	CANCELLED = "CANCELLED"
+	EXPIRED   = "EXPIRED"
+	// PENDING holds a large withdrawal until an admin approves or rejects it.
+	PENDING  = "PENDING_APPROVAL"
+	REJECTED = "REJECTED"
+)
@@ -0,0 +1,79 @@
+package limit
+
+import (
+	"fmt"
+
+	"github.com/ospiem/gophermart/internal/models"
+)
+
+// Names of the withdrawal limits as reported to clients.
+const (
+	PerTransaction = "per_transaction"
+	Daily          = "daily"
+	Monthly        = "monthly"
+	DailyCount     = "daily_count"
+	MinBalance     = "min_balance"
+	TierDaily      = "tier_daily"
+)
+
+// Limits restrict withdrawals. Zero disables a limit.
+type Limits struct {
+	PerTransaction float32
+	Daily          float32
+	Monthly        float32
+	MinBalance     float32
+	// TierDaily is the daily limit of the user's loyalty tier.
+	TierDaily  float32
+	DailyCount int
+}
+
+// Usage is what the user has withdrawn or held so far. Held points count as
+// withdrawn because they are on their way out.
+type Usage struct {
+	Today      float32
+	Month      float32
+	Balance    float32
+	TodayCount int
+}
+
+// Violation names the limit a withdrawal would break.
+type Violation struct {
+	Limit     string  `json:"limit"`
+	Max       float32 `json:"max"`
+	Remaining float32 `json:"remaining"`
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("withdraw limit %s of %g exceeded", v.Limit, v.Max)
+}
+
+func (v *Violation) Unwrap() error {
+	return models.ErrWithdrawLimitExceeded
+}
+
+// Check returns a *Violation for the first limit that withdrawing sum would break.
+func Check(l Limits, u Usage, sum float32) error {
+	if l.PerTransaction > 0 && sum > l.PerTransaction {
+		return &Violation{Limit: PerTransaction, Max: l.PerTransaction, Remaining: l.PerTransaction}
+	}
+	if l.MinBalance > 0 && u.Balance-sum < l.MinBalance {
+		return &Violation{Limit: MinBalance, Max: l.MinBalance, Remaining: max(u.Balance-l.MinBalance, 0)}
+	}
+	if l.DailyCount > 0 && u.TodayCount+1 > l.DailyCount {
+		return &Violation{Limit: DailyCount, Max: float32(l.DailyCount)}
+	}
+	for _, c := range []struct {
+		name  string
+		max   float32
+		usage float32
+	}{
+		{Daily, l.Daily, u.Today},
+		{TierDaily, l.TierDaily, u.Today},
+		{Monthly, l.Monthly, u.Month},
+	} {
+		if c.max > 0 && c.usage+sum > c.max {
+			return &Violation{Limit: c.name, Max: c.max, Remaining: max(c.max-c.usage, 0)}
+		}
+	}
+	return nil
+}
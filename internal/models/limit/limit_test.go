@@ -0,0 +1,53 @@
+package limit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	limits := Limits{PerTransaction: 500, Daily: 800, Monthly: 2000, MinBalance: 10, TierDaily: 1000, DailyCount: 3}
+	testCases := []struct {
+		name          string
+		wantLimit     string
+		usage         Usage
+		sum           float32
+		wantRemaining float32
+	}{
+		{name: "within limits", usage: Usage{Balance: 1000, Today: 100, Month: 100, TodayCount: 1}, sum: 200},
+		{name: "per transaction", usage: Usage{Balance: 1000}, sum: 600,
+			wantLimit: PerTransaction, wantRemaining: 500},
+		{name: "min balance", usage: Usage{Balance: 100}, sum: 95, wantLimit: MinBalance, wantRemaining: 90},
+		{name: "daily count", usage: Usage{Balance: 1000, TodayCount: 3}, sum: 1, wantLimit: DailyCount},
+		{name: "daily", usage: Usage{Balance: 1000, Today: 700, Month: 700}, sum: 200,
+			wantLimit: Daily, wantRemaining: 100},
+		{name: "monthly", usage: Usage{Balance: 1000, Month: 1900}, sum: 200,
+			wantLimit: Monthly, wantRemaining: 100},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Check(limits, tc.usage, tc.sum)
+			if tc.wantLimit == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var v *Violation
+			require.True(t, errors.As(err, &v))
+			assert.Equal(t, tc.wantLimit, v.Limit)
+			assert.Equal(t, tc.wantRemaining, v.Remaining)
+			assert.ErrorIs(t, err, models.ErrWithdrawLimitExceeded)
+		})
+	}
+}
+
+func TestCheckTierDaily(t *testing.T) {
+	err := Check(Limits{Daily: 1000, TierDaily: 300}, Usage{Balance: 1000, Today: 200}, 200)
+	var v *Violation
+	require.True(t, errors.As(err, &v))
+	assert.Equal(t, TierDaily, v.Limit)
+	assert.NoError(t, Check(Limits{}, Usage{}, 1e6))
+}
@@ -1,18 +1,35 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/ospiem/gophermart/internal/models/fraud"
 	"github.com/ospiem/gophermart/internal/models/status"
+	"github.com/ospiem/gophermart/internal/models/tier"
 )
 
+var ErrInsufficientBalance = errors.New("insufficient balance")
+var ErrOrderNotReversible = errors.New("only processed orders can be reversed")
+var ErrWithdrawalsBlocked = errors.New("withdrawals are blocked until the reversal debt is repaid")
+var ErrSelfTransfer = errors.New("cannot transfer points to yourself")
+var ErrTransferLimitExceeded = errors.New("daily transfer limit exceeded")
+var ErrUnknownReferral = errors.New("unknown referral code")
+var ErrReferralLoop = errors.New("referral would create a loop")
+var ErrWithdrawLimitExceeded = errors.New("withdraw limit exceeded")
+var ErrOrderOfAnotherUser = errors.New("the order number belongs to another user")
+var ErrOrderInUse = errors.New("the order number is already in use")
+var ErrUserBlocked = errors.New("the account is blocked")
+var ErrOrderReversed = errors.New("the order has been reversed")
+
 type Order struct {
 	CreatedAt time.Time
 	Status    status.Status
 	Username  string
 	ID        string
 	Accrual   float32
+	Bonus     float32
 }
 
 type OrderResponse struct {
@@ -20,10 +37,16 @@ type OrderResponse struct {
 	Status     status.Status `json:"status"`
 	Number     string        `json:"number"`
 	Accrual    float32       `json:"accrual"`
+	Bonus      float32       `json:"bonus,omitempty"`
 }
 type UserBalance struct {
 	Balance   float32 `json:"current"`
 	Withdrawn float32 `json:"withdrawn"`
+	Held      float32 `json:"held"`
+	Debt      float32 `json:"debt,omitempty"`
+	// ExpiringSoon is the part of Balance that expires within the configured window.
+	ExpiringSoon float32 `json:"expiring_soon,omitempty"`
+	Tier         string  `json:"tier"`
 }
 
 type User struct {
@@ -32,13 +55,34 @@ type User struct {
 }
 
 type Credentials struct {
-	Login string `json:"login"`
-	Pass  string `json:"password"`
+	Login        string `json:"login"`
+	Pass         string `json:"password"`
+	Referral     string `json:"referral,omitempty"`
+	Role         string `json:"-"`
+	TokenVersion int    `json:"-"`
+	Blocked      bool   `json:"-"`
 }
 
 type Claims struct {
 	jwt.RegisteredClaims
-	Login string
+	Login   string
+	Role    string
+	Scopes  []string
+	Version int
+}
+
+type PasswordChange struct {
+	OldPass string `json:"old_password"`
+	NewPass string `json:"new_password"`
+}
+
+type PasswordResetRequest struct {
+	Login string `json:"login"`
+}
+
+type PasswordResetConfirm struct {
+	Token   string `json:"token"`
+	NewPass string `json:"new_password"`
 }
 
 type Withdraw struct {
@@ -52,3 +96,170 @@ type WithdrawResponse struct {
 	Order       string    `json:"order"`
 	Sum         float32   `json:"sum"`
 }
+
+type APIKey struct {
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	ID         string     `json:"id"`
+	Username   string     `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	Key        string     `json:"key,omitempty"`
+	Scopes     []string   `json:"scopes"`
+}
+
+type APIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type UserInfo struct {
+	BlockedAt *time.Time `json:"blocked_at,omitempty"`
+	Login     string     `json:"login"`
+	Role      string     `json:"role"`
+	UserBalance
+}
+
+type AuditRecord struct {
+	CreatedAt time.Time `json:"created_at"`
+	Admin     string    `json:"admin"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Reason    string    `json:"reason"`
+}
+
+type AdminAction struct {
+	Reason string `json:"reason"`
+}
+
+type HistoryEntry struct {
+	CreatedAt time.Time `json:"created_at"`
+	Username  string    `json:"-"`
+	Kind      string    `json:"kind"`
+	Reference string    `json:"reference,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	Amount    float32   `json:"amount"`
+}
+
+type Adjustment struct {
+	CreatedAt  time.Time `json:"created_at"`
+	ID         string    `json:"id"`
+	Username   string    `json:"-"`
+	ReasonCode string    `json:"reason_code"`
+	Comment    string    `json:"comment"`
+	Admin      string    `json:"admin"`
+	Amount     float32   `json:"amount"`
+}
+
+type AdjustmentRequest struct {
+	ReasonCode string  `json:"reason_code"`
+	Comment    string  `json:"comment"`
+	Amount     float32 `json:"amount"`
+}
+
+type Reversal struct {
+	CreatedAt time.Time `json:"created_at"`
+	OrderID   string    `json:"order"`
+	Username  string    `json:"-"`
+	Policy    string    `json:"policy"`
+	Reason    string    `json:"reason"`
+	Actor     string    `json:"actor"`
+	ByAdmin   bool      `json:"-"`
+	Accrual   float32   `json:"accrual"`
+	Debited   float32   `json:"debited"`
+	Shortfall float32   `json:"shortfall"`
+}
+
+type Hold struct {
+	CreatedAt    time.Time     `json:"created_at"`
+	ExpiresAt    time.Time     `json:"expires_at"`
+	LotsExpireAt *time.Time    `json:"-"`
+	ID           string        `json:"id"`
+	Username     string        `json:"-"`
+	OrderNumber  string        `json:"order"`
+	Status       string        `json:"status"`
+	TTL          time.Duration `json:"-"`
+	Sum          float32       `json:"sum"`
+}
+
+// IdempotentResponse is the first response to a request with an Idempotency-Key.
+// StatusCode is zero while the first request is still being handled. TTL is how
+// long a newly reserved key lives.
+type IdempotentResponse struct {
+	Username    string
+	Key         string
+	RequestHash string
+	ContentType string
+	Body        []byte
+	TTL         time.Duration
+	StatusCode  int
+}
+
+type Transfer struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Sum       float32   `json:"sum"`
+}
+
+type Referral struct {
+	RewardedAt *time.Time `json:"rewarded_at,omitempty"`
+	Login      string     `json:"login"`
+	Bonus      float32    `json:"bonus"`
+	Rewarded   bool       `json:"rewarded"`
+}
+
+type Referrals struct {
+	Code      string     `json:"code"`
+	Referrals []Referral `json:"referrals"`
+	Earned    float32    `json:"earned"`
+}
+
+type Campaign struct {
+	StartsAt    time.Time `json:"starts_at"`
+	EndsAt      time.Time `json:"ends_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Tier        string    `json:"tier,omitempty"`
+	OrderPrefix string    `json:"order_prefix,omitempty"`
+	CreatedBy   string    `json:"created_by"`
+	Multiplier  float32   `json:"multiplier"`
+	FlatBonus   float32   `json:"flat_bonus"`
+}
+
+type CampaignRequest struct {
+	Campaign
+	Reason string `json:"reason"`
+}
+
+type TierChange struct {
+	CreatedAt time.Time `json:"created_at"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Lifetime  float32   `json:"lifetime"`
+}
+
+type TierStatus struct {
+	Next     *tier.Level  `json:"next,omitempty"`
+	Tier     string       `json:"tier"`
+	Changes  []TierChange `json:"changes"`
+	Perks    tier.Perks   `json:"perks"`
+	Lifetime float32      `json:"lifetime"`
+}
+
+// PendingWithdrawal is a withdrawal waiting for admin approval.
+type PendingWithdrawal struct {
+	Login string `json:"login"`
+	Hold
+}
+
+type FraudFlag struct {
+	FlaggedAt time.Time    `json:"flagged_at"`
+	Login     string       `json:"login"`
+	Reasons   []string     `json:"reasons"`
+	Signals   fraud.Counts `json:"signals"`
+}
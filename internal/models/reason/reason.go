@@ -0,0 +1,20 @@
+package reason
+
+type Code = string
+
+const (
+	Goodwill     = "GOODWILL"
+	Correction   = "CORRECTION"
+	Compensation = "COMPENSATION"
+	Fraud        = "FRAUD"
+	Other        = "OTHER"
+)
+
+func IsValid(c Code) bool {
+	switch c {
+	case Goodwill, Correction, Compensation, Fraud, Other:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,36 @@
+package reversal
+
+// Policy decides what happens when a reversed order's accrual has already been spent.
+type Policy = string
+
+const (
+	// Negative debits the whole accrual and lets the balance go below zero.
+	Negative = "negative"
+	// Partial debits at most the current balance and writes the rest off.
+	Partial = "partial"
+	// Block debits at most the current balance and keeps the rest as a debt.
+	// Withdrawals are blocked and new accruals repay the debt first until it is cleared.
+	Block = "block"
+)
+
+// IsValid reports whether p is one of the policies above.
+func IsValid(p Policy) bool {
+	switch p {
+	case Negative, Partial, Block:
+		return true
+	default:
+		return false
+	}
+}
+
+// Debit returns how much of accrual is debited from balance and the shortfall
+// that remains unpaid under the policy.
+func Debit(p Policy, balance float32, accrual float32) (debited float32, shortfall float32) {
+	if p == Negative || balance >= accrual {
+		return accrual, 0
+	}
+	if balance < 0 {
+		balance = 0
+	}
+	return balance, accrual - balance
+}
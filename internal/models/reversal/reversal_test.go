@@ -0,0 +1,31 @@
+package reversal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebit(t *testing.T) {
+	testCases := []struct {
+		name          string
+		policy        Policy
+		balance       float32
+		accrual       float32
+		wantDebited   float32
+		wantShortfall float32
+	}{
+		{name: "enough points", policy: Partial, balance: 100, accrual: 40, wantDebited: 40},
+		{name: "negative allowed", policy: Negative, balance: 10, accrual: 40, wantDebited: 40},
+		{name: "partial", policy: Partial, balance: 10, accrual: 40, wantDebited: 10, wantShortfall: 30},
+		{name: "block", policy: Block, balance: 10, accrual: 40, wantDebited: 10, wantShortfall: 30},
+		{name: "already negative", policy: Block, balance: -5, accrual: 40, wantDebited: 0, wantShortfall: 40},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			debited, shortfall := Debit(tc.policy, tc.balance, tc.accrual)
+			assert.Equal(t, tc.wantDebited, debited)
+			assert.Equal(t, tc.wantShortfall, shortfall)
+		})
+	}
+}
@@ -0,0 +1,8 @@
+package role
+
+type Role = string
+
+const (
+	User  = "user"
+	Admin = "admin"
+)
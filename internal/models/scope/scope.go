@@ -0,0 +1,39 @@
+package scope
+
+type Scope = string
+
+const (
+	OrdersRead      = "orders:read"
+	OrdersWrite     = "orders:write"
+	BalanceRead     = "balance:read"
+	BalanceWithdraw = "balance:withdraw"
+	WithdrawalsRead = "withdrawals:read"
+	OrdersReverse   = "orders:reverse"
+	// Session is held only by interactive logins and can never be granted to an API key.
+	Session = "session"
+)
+
+// Grantable lists the scopes that may be assigned to API keys.
+var Grantable = []Scope{OrdersRead, OrdersWrite, BalanceRead, BalanceWithdraw, WithdrawalsRead, OrdersReverse}
+
+func IsGrantable(s Scope) bool {
+	for _, g := range Grantable {
+		if g == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionScopes returns the scopes granted to interactive logins. OrdersReverse
+// is left out: users reverse orders only through an API key granted that scope,
+// and admins through the admin API.
+func SessionScopes() []Scope {
+	scopes := []Scope{Session}
+	for _, g := range Grantable {
+		if g != OrdersReverse {
+			scopes = append(scopes, g)
+		}
+	}
+	return scopes
+}
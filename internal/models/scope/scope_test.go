@@ -0,0 +1,15 @@
+package scope
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionScopes(t *testing.T) {
+	scopes := SessionScopes()
+	assert.Contains(t, scopes, Session)
+	assert.Contains(t, scopes, OrdersWrite)
+	assert.NotContains(t, scopes, OrdersReverse, "only granted API keys and admins may reverse orders")
+	assert.True(t, IsGrantable(OrdersReverse))
+}
@@ -7,4 +7,5 @@ const (
 	PROCESSING = "PROCESSING"
 	INVALID    = "INVALID"
 	PROCESSED  = "PROCESSED"
+	REVERSED   = "REVERSED"
 )
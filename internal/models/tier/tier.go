@@ -0,0 +1,73 @@
+package tier
+
+import "time"
+
+type Tier = string
+
+const (
+	Bronze = "BRONZE"
+	Silver = "SILVER"
+	Gold   = "GOLD"
+)
+
+func IsValid(t Tier) bool {
+	switch t {
+	case Bronze, Silver, Gold:
+		return true
+	default:
+		return false
+	}
+}
+
+// Perks are the benefits a tier grants.
+type Perks struct {
+	// Multiplier scales the base accrual of processed orders. 1 means no bonus.
+	Multiplier float32 `json:"multiplier"`
+	// DailyWithdrawLimit caps the points withdrawn or held per day. 0 means no limit.
+	DailyWithdrawLimit float32 `json:"daily_withdraw_limit,omitempty"`
+}
+
+// Level is a tier reached once the lifetime accrual gets to Threshold.
+type Level struct {
+	Name      Tier    `json:"name"`
+	Threshold float32 `json:"threshold"`
+	Perks     Perks   `json:"perks"`
+}
+
+// Rules describe the tiers. Lifetime accrual is summed over Window, and Levels
+// are ordered by ascending Threshold starting with Bronze at 0.
+type Rules struct {
+	Levels []Level
+	Window time.Duration
+}
+
+// For returns the highest level whose threshold lifetime reaches.
+func (r Rules) For(lifetime float32) Level {
+	level := Level{Name: Bronze, Perks: Perks{Multiplier: 1}}
+	for _, l := range r.Levels {
+		if lifetime >= l.Threshold {
+			level = l
+		}
+	}
+	return level
+}
+
+// Level returns the level of the named tier.
+func (r Rules) Level(t Tier) Level {
+	for _, l := range r.Levels {
+		if l.Name == t {
+			return l
+		}
+	}
+	return Level{Name: Bronze, Perks: Perks{Multiplier: 1}}
+}
+
+// Next returns the level following t, or false if t is the top tier.
+func (r Rules) Next(t Tier) (Level, bool) {
+	for i, l := range r.Levels {
+		if l.Name == t && i+1 < len(r.Levels) {
+			return r.Levels[i+1], true
+		}
+	}
+	return Level{}, false
+}
@@ -0,0 +1,37 @@
+package tier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRulesFor(t *testing.T) {
+	rules := Rules{Levels: []Level{
+		{Name: Bronze, Perks: Perks{Multiplier: 1}},
+		{Name: Silver, Threshold: 1000, Perks: Perks{Multiplier: 1.1}},
+		{Name: Gold, Threshold: 5000, Perks: Perks{Multiplier: 1.25}},
+	}}
+	testCases := []struct {
+		name     string
+		want     Tier
+		lifetime float32
+	}{
+		{name: "nothing accrued", lifetime: 0, want: Bronze},
+		{name: "below silver", lifetime: 999.5, want: Bronze},
+		{name: "silver threshold", lifetime: 1000, want: Silver},
+		{name: "gold", lifetime: 12000, want: Gold},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, rules.For(tc.lifetime).Name)
+		})
+	}
+
+	next, ok := rules.Next(Silver)
+	assert.True(t, ok)
+	assert.Equal(t, Gold, next.Name)
+	_, ok = rules.Next(Gold)
+	assert.False(t, ok)
+	assert.Equal(t, float32(1), Rules{}.For(100).Perks.Multiplier)
+}
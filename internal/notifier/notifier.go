@@ -0,0 +1,76 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const Log = "log"
+const File = "file"
+
+const filePerm = 0o600
+
+// Notifier delivers password reset tokens to users.
+type Notifier interface {
+	SendResetToken(ctx context.Context, login string, token string, expiresAt time.Time) error
+}
+
+// New returns the notifier selected by kind. Unknown kinds fall back to the log notifier.
+func New(kind string, path string, l zerolog.Logger) Notifier {
+	if kind == File {
+		return &FileNotifier{path: path}
+	}
+	return &LogNotifier{log: l.With().Str("notifier", Log).Logger()}
+}
+
+// LogNotifier writes reset tokens to the service log. It is meant for local and offline use only.
+type LogNotifier struct {
+	log zerolog.Logger
+}
+
+func (n *LogNotifier) SendResetToken(_ context.Context, login string, token string, expiresAt time.Time) error {
+	n.log.Info().
+		Str("login", login).
+		Str("token", token).
+		Time("expires_at", expiresAt).
+		Msg("password reset token")
+	return nil
+}
+
+// FileNotifier appends reset tokens to a file as JSON lines.
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+type resetMessage struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	Login     string    `json:"login"`
+	Token     string    `json:"token"`
+}
+
+func (n *FileNotifier) SendResetToken(_ context.Context, login string, token string, expiresAt time.Time) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, filePerm)
+	if err != nil {
+		return fmt.Errorf("cannot open notifier file: %w", err)
+	}
+
+	msg := resetMessage{ExpiresAt: expiresAt, Login: login, Token: token}
+	if err := json.NewEncoder(f).Encode(msg); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("cannot write reset token: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("cannot close notifier file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.jsonl")
+	n := New(File, path, zerolog.Nop())
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	require.NoError(t, n.SendResetToken(context.Background(), "alice", "token-1", expiresAt))
+	require.NoError(t, n.SendResetToken(context.Background(), "bob", "token-2", expiresAt))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	var got []resetMessage
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		msg := resetMessage{}
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &msg))
+		got = append(got, msg)
+	}
+	require.NoError(t, sc.Err())
+	assert.Equal(t, []resetMessage{
+		{ExpiresAt: expiresAt, Login: "alice", Token: "token-1"},
+		{ExpiresAt: expiresAt, Login: "bob", Token: "token-2"},
+	}, got)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(filePerm), info.Mode().Perm(), "tokens must not be readable by others")
+}
+
+func TestNewFallsBackToLog(t *testing.T) {
+	assert.IsType(t, &LogNotifier{}, New("unknown", "", zerolog.Nop()))
+	assert.IsType(t, &LogNotifier{}, New(Log, "", zerolog.Nop()))
+}
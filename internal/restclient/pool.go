@@ -0,0 +1,64 @@
+package restclient
+
+import "sync"
+
+// pool keeps track of the running order workers so that their number can
+// change while the client runs. Each worker has its own stop channel: a worker
+// told to stop finishes the order in hand first.
+type pool struct {
+	mu    sync.Mutex
+	stops []chan struct{}
+	start func(stop <-chan struct{})
+}
+
+// run starts n workers with start and keeps start for later resizes.
+func (p *pool) run(start func(stop <-chan struct{}), n int) {
+	p.mu.Lock()
+	p.start = start
+	p.mu.Unlock()
+	p.resize(n)
+}
+
+// resize starts or stops workers until n are running and returns how many
+// were running before. It reports false if the pool is not running yet.
+func (p *pool) resize(n int) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.start == nil {
+		return 0, false
+	}
+	before := len(p.stops)
+	for len(p.stops) < n {
+		stop := make(chan struct{})
+		p.stops = append(p.stops, stop)
+		p.start(stop)
+	}
+	for len(p.stops) > n {
+		last := len(p.stops) - 1
+		close(p.stops[last])
+		p.stops = p.stops[:last]
+	}
+	return before, true
+}
+
+// stop stops all workers for good: later resizes have no effect. It returns
+// how many were running.
+func (p *pool) stop() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := len(p.stops)
+	for _, stop := range p.stops {
+		close(stop)
+	}
+	p.stops = nil
+	p.start = nil
+	return n
+}
+
+func (p *pool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.stops)
+}
@@ -0,0 +1,58 @@
+package restclient
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolResize(t *testing.T) {
+	tests := []struct {
+		name    string
+		sizes   []int
+		running int
+	}{
+		{name: "grow", sizes: []int{2, 5}, running: 5},
+		{name: "shrink", sizes: []int{5, 2}, running: 2},
+		{name: "stop all", sizes: []int{3, 0}, running: 0},
+		{name: "same size", sizes: []int{3, 3}, running: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wg := &sync.WaitGroup{}
+			mu := &sync.Mutex{}
+			running := 0
+			p := &pool{}
+			_, ok := p.resize(1)
+			assert.False(t, ok)
+
+			p.run(func(stop <-chan struct{}) {
+				mu.Lock()
+				running++
+				mu.Unlock()
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-stop
+					mu.Lock()
+					running--
+					mu.Unlock()
+				}()
+			}, 0)
+
+			before := 0
+			for _, n := range tt.sizes {
+				got, ok := p.resize(n)
+				assert.True(t, ok)
+				assert.Equal(t, before, got)
+				before = n
+			}
+			assert.Equal(t, tt.running, p.size())
+
+			p.resize(0)
+			wg.Wait()
+			assert.Equal(t, 0, running)
+		})
+	}
+}
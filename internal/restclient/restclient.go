@@ -7,12 +7,20 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ospiem/gophermart/internal/config"
+	"github.com/ospiem/gophermart/internal/metrics"
 	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/status"
+	"github.com/ospiem/gophermart/internal/tlsutil"
+	"github.com/ospiem/gophermart/internal/tracing"
 	"github.com/rs/zerolog"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var ErrOrderNotRegister = errors.New("the order does not registered")
@@ -21,34 +29,117 @@ var ErrTooManyRequests = errors.New("too many requests")
 const DelayTime = "delayTime"
 
 type Storage interface {
-	ProcessOrderWithBonuses(ctx context.Context, orders models.Order, l *zerolog.Logger) error
+	ProcessOrderWithBonuses(ctx context.Context, orders models.Order) error
 	SelectOrdersToProceed(ctx context.Context, pagination int, offset *int) ([]models.Order, error)
 }
 type RestClient struct {
 	Storage Storage
+	Metrics *metrics.Metrics
 	Logger  *zerolog.Logger
 	Cfg     *config.Config
+	// Client calls the accrual system. New sets it up with the accrual TLS
+	// settings of the configuration.
+	Client *http.Client
+
+	cert       *tlsutil.Certificate
+	workers    pool
+	pagination atomic.Int64
 }
 
-func New(cfg *config.Config, s Storage, l *zerolog.Logger) *RestClient {
-	return &RestClient{
+func New(cfg *config.Config, s Storage, m *metrics.Metrics, l *zerolog.Logger) (*RestClient, error) {
+	r := &RestClient{
 		Storage: s,
+		Metrics: m,
 		Logger:  l,
 		Cfg:     cfg,
+		Client:  &http.Client{},
+	}
+	r.pagination.Store(int64(cfg.Pagination))
+
+	// The minimum TLS version applies to any https accrual system, not only to
+	// one that needs a client certificate or a private CA.
+	https := strings.HasPrefix(strings.ToLower(cfg.AccrualSysAddress), "https://")
+	if https || cfg.AccrualCertFile != "" || cfg.AccrualCAFile != "" {
+		if cfg.AccrualCertFile != "" {
+			cert, err := tlsutil.LoadCertificate(cfg.AccrualCertFile, cfg.AccrualKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("cannot load accrual client certificate: %w", err)
+			}
+			r.cert = cert
+		}
+		version, err := tlsutil.ParseVersion(cfg.AccrualTLSVersion)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse accrual TLS version: %w", err)
+		}
+		tlsConfig, err := tlsutil.ClientConfig(r.cert, cfg.AccrualCAFile, version)
+		if err != nil {
+			return nil, fmt.Errorf("cannot configure accrual TLS: %w", err)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		r.Client.Transport = transport
 	}
+	return r, nil
+}
+
+// Resize grows or shrinks the running worker pool to n workers. Stopped
+// workers finish the order in hand. It has no effect before Run.
+func (r *RestClient) Resize(n int) {
+	if before, ok := r.workers.resize(n); ok && before != n {
+		r.Logger.Info().Msgf("Resized worker pool from %d to %d", before, n)
+	}
+}
+
+// SetPagination sets how many orders the connection manager fetches at once.
+func (r *RestClient) SetPagination(n int) {
+	r.pagination.Store(int64(n))
+}
+
+// Ping checks that the accrual system answers HTTP. Any response will do: the
+// point is whether the workers can reach it at all.
+func (r *RestClient) Ping(ctx context.Context) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, r.Cfg.AccrualSysAddress, nil)
+	if err != nil {
+		return fmt.Errorf("cannot generate request: %w", err)
+	}
+	resp, err := r.Client.Do(request)
+	if err != nil {
+		return fmt.Errorf("accrual system is unreachable: %w", err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		return fmt.Errorf("cannot close body: %w", err)
+	}
+	return nil
 }
 
 func (r *RestClient) Run(ctx context.Context, wg *sync.WaitGroup) {
 	logger := r.Logger.With().Str("func", "Run").Logger()
+	if r.cert != nil {
+		r.cert.Watch(ctx, wg, r.Logger)
+	}
 	mu := &sync.RWMutex{}
 	delayMap := make(map[string]int, 1)
+	// The queue keeps its initial capacity when the pool is resized.
 	orderCh := make(chan models.Order, r.Cfg.Pagination*r.Cfg.WorkersNum)
+	r.Metrics.RegisterQueue("orders", func() int { return len(orderCh) })
 
-	for i := 0; i < r.Cfg.WorkersNum; i++ {
-		wg.Add(1)
-		go r.ProcessOrder(ctx, wg, mu, delayMap, orderCh)
-		logger.Debug().Msgf("Started worker #%d", i+1)
-	}
+	// Workers outlive ctx by up to the drain timeout, so that an order whose
+	// accrual has been fetched is still stored.
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	workers := &sync.WaitGroup{}
+	r.workers.run(func(stop <-chan struct{}) {
+		workers.Add(1)
+		go r.ProcessOrder(workCtx, workers, stop, mu, delayMap, orderCh)
+	}, r.Cfg.WorkersNum)
+	logger.Debug().Msgf("Started %d workers", r.Cfg.WorkersNum)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer cancelWork()
+		<-ctx.Done()
+		r.drain(workers, cancelWork, logger)
+	}()
 
 	wg.Add(1)
 	// Connection manager
@@ -70,19 +161,28 @@ func (r *RestClient) Run(ctx context.Context, wg *sync.WaitGroup) {
 				if delay != 0 {
 					// If delay is not zero, sleep and reset delay in delayMap using Lock
 					mu.Lock()
-					time.Sleep(time.Duration(delay) * time.Second)
+					select {
+					case <-ctx.Done():
+					case <-time.After(time.Duration(delay) * time.Second):
+					}
 					delayMap[DelayTime] = 0
 					mu.Unlock()
 				}
 
 				// Fetch orders from storage
-				orders, err := r.Storage.SelectOrdersToProceed(ctx, r.Cfg.Pagination, &offset)
+				orders, err := r.Storage.SelectOrdersToProceed(ctx, int(r.pagination.Load()), &offset)
 				if err != nil {
 					logger.Error().Err(err).Msg("cannot select order to proceed")
 				}
-				// Send orders to orderCh
+				// Send orders to orderCh. Orders not sent on shutdown are
+				// fetched again on the next start.
 				for _, o := range orders {
-					orderCh <- o
+					select {
+					case <-ctx.Done():
+						logger.Info().Msg("Stopped connection manager")
+						return
+					case orderCh <- o:
+					}
 				}
 				offset += len(orders)
 			}
@@ -90,43 +190,104 @@ func (r *RestClient) Run(ctx context.Context, wg *sync.WaitGroup) {
 	}()
 }
 
-func (r *RestClient) ProcessOrder(ctx context.Context, wg *sync.WaitGroup, mu *sync.RWMutex,
+// drain stops the workers and waits for them to finish the orders in hand. If
+// that takes longer than the drain timeout, the orders are cancelled.
+func (r *RestClient) drain(workers *sync.WaitGroup, cancelWork context.CancelFunc, logger zerolog.Logger) {
+	n := r.workers.stop()
+	logger.Info().Msgf("Waiting up to %s for %d workers to finish in-flight orders", r.Cfg.WorkerDrainTimeout, n)
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(r.Cfg.WorkerDrainTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		logger.Info().Msg("Workers have finished")
+	case <-timer.C:
+		logger.Warn().Msg("drain timeout has passed, cancelling in-flight orders")
+		cancelWork()
+		<-done
+		logger.Info().Msg("Workers have stopped")
+	}
+}
+
+// ProcessOrder handles orders from jobs until ctx is done or stop is closed.
+// A worker told to stop finishes the order in hand first.
+func (r *RestClient) ProcessOrder(ctx context.Context, wg *sync.WaitGroup, stop <-chan struct{}, mu *sync.RWMutex,
 	delayMap map[string]int, jobs chan models.Order) {
 	logger := r.Logger.With().Str("func", "ProcessOrder").Logger()
 	defer wg.Done()
 
 	for {
+		// Stopping wins over taking another order.
+		select {
+		case <-stop:
+			logger.Info().Msg("Stopped worker")
+			return
+		default:
+		}
+
 		select {
 		case <-ctx.Done():
 			logger.Info().Msg("Stopped worker")
 			return
 
+		case <-stop:
+			logger.Info().Msg("Stopped worker")
+			return
+
 		case order := <-jobs:
 			logger.Debug().Msgf("got new order %s", order.ID)
-			updatedOrder, err := r.getOrderStatusFromService(ctx, order, mu, delayMap)
-			if err != nil {
-				if !errors.Is(err, ErrOrderNotRegister) && !errors.Is(err, ErrTooManyRequests) {
-					logger.Error().Err(err).Msg("cannot get order status from accrual")
-					continue
-				}
-				// error is ErrOrderNotRegister or ErrTooManyRequests
-				continue
-			}
-			if err := r.Storage.ProcessOrderWithBonuses(ctx, updatedOrder, r.Logger); err != nil {
-				logger.Error().Err(err).Msg("cannot proceed order with bonuses")
-			}
+			r.handleOrder(ctx, order, mu, delayMap, logger)
+		}
+	}
+}
+
+// handleOrder polls the accrual system for the order and stores the result,
+// all in one trace.
+func (r *RestClient) handleOrder(ctx context.Context, order models.Order, mu *sync.RWMutex,
+	delayMap map[string]int, logger zerolog.Logger) {
+	ctx, span := tracing.Start(ctx, "restclient.ProcessOrder")
+	defer span.End()
+	logger = tracing.WithIDs(ctx, logger.With().Str("order", order.ID)).Logger()
+	ctx = logger.WithContext(ctx)
+
+	updatedOrder, err := r.getOrderStatusFromService(ctx, order, mu, delayMap)
+	if err != nil {
+		if !errors.Is(err, ErrOrderNotRegister) && !errors.Is(err, ErrTooManyRequests) {
+			logger.Error().Err(err).Msg("cannot get order status from accrual")
 		}
+		// error is ErrOrderNotRegister or ErrTooManyRequests
+		return
+	}
+	if err := r.Storage.ProcessOrderWithBonuses(ctx, updatedOrder); err != nil {
+		logger.Error().Err(err).Msg("cannot proceed order with bonuses")
+		return
+	}
+	if updatedOrder.Status == status.PROCESSED {
+		r.Metrics.PointsAccrued(updatedOrder.Accrual)
 	}
 }
 
 func (r *RestClient) getOrderStatusFromService(ctx context.Context, order models.Order, mu *sync.RWMutex,
-	delayMap map[string]int) (models.Order, error) {
+	delayMap map[string]int) (_ models.Order, err error) {
+	ctx, span := tracing.Start(ctx, "accrual.GetOrder", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() {
+		if errors.Is(err, ErrOrderNotRegister) {
+			span.End()
+			return
+		}
+		tracing.End(span, err)
+	}()
+
 	logger := r.Logger.With().Str("func", "getOrderStatusFromService").Logger()
 	// Read from the map to check if the accrual service is available for establishing connections.
 	mu.RLock()
 	_ = delayMap[DelayTime]
 	mu.RUnlock()
-	client := http.Client{}
 
 	apiURL := fmt.Sprintf("%v/api/orders/%v", r.Cfg.AccrualSysAddress, order.ID)
 	request, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
@@ -135,10 +296,15 @@ func (r *RestClient) getOrderStatusFromService(ctx context.Context, order models
 	}
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("Content-Encoding", "gzip")
+	tracing.Inject(ctx, request.Header)
 
-	resp, err := client.Do(request)
+	resp, err := r.Client.Do(request)
 	if err != nil {
 		logger.Error().Err(err).Msg("cannot proceed request to accrual")
+		r.Metrics.AccrualError()
+	} else {
+		r.Metrics.AccrualResponse(resp.StatusCode)
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
 	}
 	defer func() {
 		if resp != nil {
@@ -0,0 +1,125 @@
+package restclient
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ospiem/gophermart/internal/config"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type drainStorage struct {
+	mu        sync.Mutex
+	fetched   bool
+	processed []models.Order
+	ctxErr    error
+}
+
+func (s *drainStorage) SelectOrdersToProceed(ctx context.Context, _ int, _ *int) ([]models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fetched {
+		time.Sleep(time.Millisecond)
+		return nil, nil
+	}
+	s.fetched = true
+	return []models.Order{{ID: "12345678903"}}, nil
+}
+
+func (s *drainStorage) ProcessOrderWithBonuses(ctx context.Context, order models.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.processed = append(s.processed, order)
+	s.ctxErr = ctx.Err()
+	return nil
+}
+
+func TestRunDrain(t *testing.T) {
+	tests := []struct {
+		name          string
+		respondAfter  time.Duration
+		drainTimeout  time.Duration
+		wantProcessed bool
+	}{
+		{name: "in-flight order finishes", respondAfter: 50 * time.Millisecond, drainTimeout: 5 * time.Second,
+			wantProcessed: true},
+		{name: "drain timeout cancels order", respondAfter: 5 * time.Second, drainTimeout: 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{})
+			accrual := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(tt.respondAfter):
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"order":"12345678903","status":"PROCESSED","accrual":10}`))
+			}))
+			defer accrual.Close()
+
+			cfg := &config.Config{AccrualSysAddress: accrual.URL, Pagination: 1, WorkersNum: 2,
+				WorkerDrainTimeout: tt.drainTimeout}
+			s := &drainStorage{}
+			l := zerolog.Nop()
+			r, err := New(cfg, s, nil, &l)
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			wg := &sync.WaitGroup{}
+			r.Run(ctx, wg)
+
+			<-started
+			cancel()
+			wg.Wait()
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if !tt.wantProcessed {
+				assert.Empty(t, s.processed)
+				return
+			}
+			require.Len(t, s.processed, 1)
+			assert.NoError(t, s.ctxErr, "the order must be stored with a live context")
+			_, ok := r.workers.resize(1)
+			assert.False(t, ok, "no worker may start after shutdown")
+		})
+	}
+}
+
+func TestNewTLSVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		address     string
+		wantVersion uint16
+	}{
+		{name: "plain http", address: "http://accrual:8080"},
+		{name: "https without certificates", address: "https://accrual:8443", wantVersion: tls.VersionTLS13},
+		{name: "https in upper case", address: "HTTPS://accrual:8443", wantVersion: tls.VersionTLS13},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{AccrualSysAddress: tt.address, AccrualTLSVersion: "1.3"}
+			l := zerolog.Nop()
+			r, err := New(cfg, nil, nil, &l)
+			require.NoError(t, err)
+			if tt.wantVersion == 0 {
+				assert.Nil(t, r.Client.Transport)
+				return
+			}
+			transport, ok := r.Client.Transport.(*http.Transport)
+			require.True(t, ok)
+			assert.Equal(t, tt.wantVersion, transport.TLSClientConfig.MinVersion)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/status"
+)
+
+const userInfoColumns = `login, role, blocked_at, COALESCE(balance, 0), COALESCE(total_withdrawn, 0)`
+
+func scanUserInfo(row pgx.Row) (models.UserInfo, error) {
+	u := models.UserInfo{}
+	if err := row.Scan(&u.Login, &u.Role, &u.BlockedAt, &u.Balance, &u.Withdrawn); err != nil {
+		return models.UserInfo{}, fmt.Errorf("cannot scan user: %w", err)
+	}
+	return u, nil
+}
+
+// likeEscaper makes LIKE treat the metacharacters of a search term literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchUsers returns users whose login contains query.
+func (db *DB) SearchUsers(ctx context.Context, query string, limit int) ([]models.UserInfo, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT `+userInfoColumns+` FROM users WHERE login ILIKE '%' || $1 || '%' ESCAPE '\' ORDER BY login LIMIT $2`,
+		likeEscaper.Replace(query), limit)
+	if err != nil {
+		return nil, fmt.Errorf("postgres failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	users := make([]models.UserInfo, 0, limit)
+	for rows.Next() {
+		u, err := scanUserInfo(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+func (db *DB) SelectUserInfo(ctx context.Context, login string) (models.UserInfo, error) {
+	return scanUserInfo(db.pool.QueryRow(ctx, `SELECT `+userInfoColumns+` FROM users WHERE login = $1`, login))
+}
+
+// SetUserBlocked blocks or unblocks the user. Blocking also invalidates the user's tokens.
+func (db *DB) SetUserBlocked(ctx context.Context, login string, blocked bool, rec models.AuditRecord) error {
+	return db.withTx(ctx, "SetUserBlocked", func(tx pgx.Tx) error {
+		query := `UPDATE users SET blocked_at = NULL WHERE login = $1`
+		if blocked {
+			query = `UPDATE users SET blocked_at = now(), token_version = token_version + 1 WHERE login = $1`
+		}
+		if err := updateWithRetry(ctx, tx, query, login); err != nil {
+			return fmt.Errorf("cannot update user: %w", err)
+		}
+		return insertAuditRecord(ctx, tx, rec)
+	})
+}
+
+// RepollOrder puts an unprocessed order back into the accrual polling queue.
+func (db *DB) RepollOrder(ctx context.Context, id string, rec models.AuditRecord) error {
+	return db.withTx(ctx, "RepollOrder", func(tx pgx.Tx) error {
+		if err := updateOrderStatus(ctx, tx, id, status.NEW); err != nil {
+			return err
+		}
+		return insertAuditRecord(ctx, tx, rec)
+	})
+}
+
+// InvalidateOrder marks an unprocessed order INVALID so that it is no longer polled.
+func (db *DB) InvalidateOrder(ctx context.Context, id string, rec models.AuditRecord) error {
+	return db.withTx(ctx, "InvalidateOrder", func(tx pgx.Tx) error {
+		if err := updateOrderStatus(ctx, tx, id, status.INVALID); err != nil {
+			return err
+		}
+		return insertAuditRecord(ctx, tx, rec)
+	})
+}
+
+// updateOrderStatus never touches PROCESSED orders because their accrual is already credited,
+// nor REVERSED ones because polling them again would credit the accrual a second time.
+// It returns models.ErrOrderReversed for a reversed order and pgx.ErrNoRows when there
+// is no such unprocessed order.
+func updateOrderStatus(ctx context.Context, tx pgx.Tx, id string, s status.Status) error {
+	tag, err := tx.Exec(ctx, `UPDATE orders SET status = $1 WHERE id = $2 AND status NOT IN ($3, $4)`,
+		s, id, status.PROCESSED, status.REVERSED)
+	if err != nil {
+		return fmt.Errorf("cannot update order status: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		var current status.Status
+		if err := tx.QueryRow(ctx, `SELECT status FROM orders WHERE id = $1`, id).Scan(&current); err != nil {
+			return fmt.Errorf("cannot update order status: %w", err)
+		}
+		if current == status.REVERSED {
+			return models.ErrOrderReversed
+		}
+		return fmt.Errorf("cannot update order status: %w", pgx.ErrNoRows)
+	}
+	return nil
+}
+
+func (db *DB) AdminRevokeAPIKey(ctx context.Context, login string, id string, rec models.AuditRecord) error {
+	return db.withTx(ctx, "AdminRevokeAPIKey", func(tx pgx.Tx) error {
+		if err := revokeAPIKey(ctx, tx, login, id); err != nil {
+			return err
+		}
+		return insertAuditRecord(ctx, tx, rec)
+	})
+}
+
+func (db *DB) SelectAuditRecords(ctx context.Context, limit int) ([]models.AuditRecord, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT admin, action, target, reason, created_at FROM admin_audit ORDER BY created_at DESC LIMIT $1`,
+		limit)
+	if err != nil {
+		return nil, fmt.Errorf("postgres failed to get audit records: %w", err)
+	}
+	defer rows.Close()
+
+	records := make([]models.AuditRecord, 0, limit)
+	for rows.Next() {
+		r := models.AuditRecord{}
+		if err := rows.Scan(&r.Admin, &r.Action, &r.Target, &r.Reason, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("cannot scan audit record: %w", err)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+func insertAuditRecord(ctx context.Context, tx pgx.Tx, rec models.AuditRecord) error {
+	err := updateWithRetry(ctx, tx,
+		`INSERT INTO admin_audit (admin, action, target, reason) VALUES ($1, $2, $3, $4)`,
+		rec.Admin, rec.Action, rec.Target, rec.Reason)
+	if err != nil {
+		return fmt.Errorf("cannot insert audit record: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/reversal"
+	"github.com/ospiem/gophermart/internal/models/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchUsersEscapesPatterns(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	prefix := uniqueLogin("search")
+	plain, underscore, percent := prefix+"ab", prefix+"a_b", prefix+"a%b"
+	for _, login := range []string{plain, underscore, percent} {
+		seedUser(t, db, login, 0)
+	}
+	cleanupUsers(t, db, plain, underscore, percent)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "underscore", query: prefix + "a_", want: []string{underscore}},
+		{name: "percent", query: prefix + "a%", want: []string{percent}},
+		{name: "plain", query: prefix, want: []string{plain, percent, underscore}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, err := db.SearchUsers(ctx, tt.query, 10)
+			require.NoError(t, err)
+			got := make([]string, 0, len(users))
+			for _, u := range users {
+				got = append(got, u.Login)
+			}
+			assert.ElementsMatch(t, tt.want, got)
+		})
+	}
+}
+
+func TestAdminActionsWriteAudit(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	admin, login := uniqueLogin("audit_admin"), uniqueLogin("audit_user")
+	seedUser(t, db, admin, 0)
+	seedUser(t, db, login, 0)
+	cleanupUsers(t, db, admin, login)
+
+	rec := models.AuditRecord{Admin: admin, Action: "block_user", Target: login, Reason: "test"}
+	require.NoError(t, db.SetUserBlocked(ctx, login, true, rec))
+	u, err := db.SelectUserInfo(ctx, login)
+	require.NoError(t, err)
+	assert.NotNil(t, u.BlockedAt)
+
+	records, err := db.SelectAuditRecords(ctx, 10)
+	require.NoError(t, err)
+	found := false
+	for _, r := range records {
+		if r.Admin == admin {
+			found = true
+			assert.Equal(t, rec.Action, r.Action)
+			assert.Equal(t, rec.Target, r.Target)
+			assert.Equal(t, rec.Reason, r.Reason)
+		}
+	}
+	assert.True(t, found, "blocking must leave an audit record")
+}
+
+func TestReversedOrderIsNotCreditedAgain(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	admin, login := uniqueLogin("reversed_admin"), uniqueLogin("reversed_user")
+	seedUser(t, db, admin, 0)
+	seedUser(t, db, login, 0)
+	cleanupUsers(t, db, admin, login)
+
+	id := uniqueOrder()
+	require.NoError(t, db.InsertOrder(ctx, models.Order{ID: id, Status: status.NEW, Username: login}))
+	processed := models.Order{ID: id, Status: status.PROCESSED, Accrual: 100}
+	require.NoError(t, db.ProcessOrderWithBonuses(ctx, processed))
+	_, err := db.ReverseOrder(ctx, models.Reversal{OrderID: id, Policy: reversal.Negative, Reason: "refund",
+		Actor: admin})
+	require.NoError(t, err)
+
+	rec := models.AuditRecord{Admin: admin, Action: "repoll_order", Target: id, Reason: "test"}
+	err = db.RepollOrder(ctx, id, rec)
+	assert.True(t, errors.Is(err, models.ErrOrderReversed), "got %v", err)
+	rec.Action = "invalidate_order"
+	err = db.InvalidateOrder(ctx, id, rec)
+	assert.True(t, errors.Is(err, models.ErrOrderReversed), "got %v", err)
+
+	err = db.ProcessOrderWithBonuses(ctx, processed)
+	assert.True(t, errors.Is(err, pgx.ErrNoRows), "a stale copy must not credit a reversed order, got %v", err)
+	b, err := db.SelectUserBalance(ctx, login)
+	require.NoError(t, err)
+	assert.Zero(t, b.Balance)
+}
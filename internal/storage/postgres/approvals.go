@@ -0,0 +1,82 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/hold"
+)
+
+func (db *DB) SelectPendingWithdrawals(ctx context.Context, limit int) ([]models.PendingWithdrawal, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT username, `+holdColumns+` FROM balance_holds WHERE status = $1 ORDER BY created_at LIMIT $2`,
+		hold.PENDING, limit)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select pending withdrawals: %w", err)
+	}
+	defer rows.Close()
+
+	pending := make([]models.PendingWithdrawal, 0)
+	for rows.Next() {
+		p := models.PendingWithdrawal{}
+		err := rows.Scan(&p.Login, &p.ID, &p.OrderNumber, &p.Sum, &p.Status, &p.CreatedAt, &p.ExpiresAt,
+			&p.LotsExpireAt)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan pending withdrawal: %w", err)
+		}
+		p.Username = p.Login
+		pending = append(pending, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read pending withdrawals: %w", err)
+	}
+	return pending, nil
+}
+
+// ApproveWithdrawal turns a withdrawal pending approval into a withdrawal. It
+// returns pgx.ErrNoRows when there is no such pending withdrawal.
+func (db *DB) ApproveWithdrawal(ctx context.Context, id string, rec models.AuditRecord) (models.Hold, error) {
+	return db.resolvePending(ctx, "ApproveWithdrawal", id, hold.CONFIRMED, rec,
+		func(tx pgx.Tx, h models.Hold) error {
+			return confirmHold(ctx, tx, h)
+		})
+}
+
+// RejectWithdrawal returns the points of a withdrawal pending approval to the
+// user. It returns pgx.ErrNoRows when there is no such pending withdrawal.
+func (db *DB) RejectWithdrawal(ctx context.Context, id string, rec models.AuditRecord) (models.Hold, error) {
+	return db.resolvePending(ctx, "RejectWithdrawal", id, hold.REJECTED, rec,
+		func(tx pgx.Tx, h models.Hold) error {
+			return releaseHold(ctx, tx, h)
+		})
+}
+
+// resolvePending locks a pending withdrawal, moves it to status st with
+// resolve and writes the audit record.
+func (db *DB) resolvePending(ctx context.Context, method string, id string, st hold.Status,
+	rec models.AuditRecord, resolve func(tx pgx.Tx, h models.Hold) error) (models.Hold, error) {
+	var h models.Hold
+	err := db.withTx(ctx, method, func(tx pgx.Tx) error {
+		var login string
+		row := tx.QueryRow(ctx, `SELECT username FROM balance_holds WHERE id::text = $1 AND status = $2`,
+			id, hold.PENDING)
+		if err := row.Scan(&login); err != nil {
+			return fmt.Errorf("cannot select pending withdrawal: %w", err)
+		}
+		var err error
+		if h, err = lockHold(ctx, tx, login, id, hold.PENDING, false); err != nil {
+			return err
+		}
+		h.Status = st
+		if err := resolve(tx, h); err != nil {
+			return err
+		}
+		return insertAuditRecord(ctx, tx, rec)
+	})
+	if err != nil {
+		return models.Hold{}, err
+	}
+	return h, nil
+}
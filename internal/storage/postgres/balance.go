@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/history"
+)
+
+const auditAdjustBalance = "adjust_balance"
+
+// AdjustBalance credits or debits the user's balance by adj.Amount. The balance
+// may not become negative. The adjustment is recorded in the append-only
+// adjustments table, in the user's balance history and in the admin audit.
+func (db *DB) AdjustBalance(ctx context.Context, adj models.Adjustment) (models.Adjustment, error) {
+	err := db.withTx(ctx, "AdjustBalance", func(tx pgx.Tx) error {
+		balance, err := lockUserBalance(ctx, tx, adj.Username)
+		if err != nil {
+			return err
+		}
+		if balance+adj.Amount < 0 {
+			return models.ErrInsufficientBalance
+		}
+
+		err = updateWithRetry(ctx, tx, `UPDATE users SET balance = COALESCE(balance, 0) + $1 WHERE login = $2`,
+			adj.Amount, adj.Username)
+		if err != nil {
+			return fmt.Errorf("cannot update user's balance: %w", err)
+		}
+		if err := db.addLot(ctx, tx, adj.Username, adj.Amount, adj.ReasonCode); err != nil {
+			return err
+		}
+		if _, err := consumeLots(ctx, tx, adj.Username, -adj.Amount); err != nil {
+			return err
+		}
+
+		row := tx.QueryRow(ctx,
+			`INSERT INTO balance_adjustments (username, amount, reason_code, comment, admin)
+				VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+			adj.Username, adj.Amount, adj.ReasonCode, adj.Comment, adj.Admin)
+		if err := row.Scan(&adj.ID, &adj.CreatedAt); err != nil {
+			return fmt.Errorf("cannot insert adjustment: %w", err)
+		}
+
+		err = insertHistory(ctx, tx, models.HistoryEntry{
+			Username:  adj.Username,
+			Kind:      history.Adjustment,
+			Amount:    adj.Amount,
+			Reference: adj.ReasonCode,
+			Comment:   adj.Comment,
+		})
+		if err != nil {
+			return err
+		}
+
+		return insertAuditRecord(ctx, tx, models.AuditRecord{
+			Admin:  adj.Admin,
+			Action: auditAdjustBalance,
+			Target: adj.Username,
+			Reason: fmt.Sprintf("%s: %s (%+.2f)", adj.ReasonCode, adj.Comment, adj.Amount),
+		})
+	})
+	if err != nil {
+		return models.Adjustment{}, err
+	}
+	return adj, nil
+}
+
+func (db *DB) SelectAdjustments(ctx context.Context, login string) ([]models.Adjustment, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT id, amount, reason_code, comment, admin, created_at FROM balance_adjustments
+			WHERE username = $1 ORDER BY created_at DESC`, login)
+	if err != nil {
+		return nil, fmt.Errorf("postgres failed to get adjustments: %w", err)
+	}
+	defer rows.Close()
+
+	adjustments := make([]models.Adjustment, 0)
+	for rows.Next() {
+		a := models.Adjustment{Username: login}
+		if err := rows.Scan(&a.ID, &a.Amount, &a.ReasonCode, &a.Comment, &a.Admin, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("cannot scan adjustment: %w", err)
+		}
+		adjustments = append(adjustments, a)
+	}
+	return adjustments, nil
+}
+
+func (db *DB) SelectBalanceHistory(ctx context.Context, login string) ([]models.HistoryEntry, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT kind, amount, COALESCE(reference, ''), COALESCE(comment, ''), created_at FROM balance_history
+			WHERE username = $1 ORDER BY created_at DESC`, login)
+	if err != nil {
+		return nil, fmt.Errorf("postgres failed to get balance history: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]models.HistoryEntry, 0)
+	for rows.Next() {
+		e := models.HistoryEntry{Username: login}
+		if err := rows.Scan(&e.Kind, &e.Amount, &e.Reference, &e.Comment, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("cannot scan history entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// lockUserBalance locks the user's row until the end of tx and returns the balance.
+func lockUserBalance(ctx context.Context, tx pgx.Tx, login string) (float32, error) {
+	var balance float32
+	row := tx.QueryRow(ctx, `SELECT COALESCE(balance, 0) FROM users WHERE login = $1 FOR UPDATE`, login)
+	if err := row.Scan(&balance); err != nil {
+		return 0, fmt.Errorf("cannot lock user's balance: %w", err)
+	}
+	return balance, nil
+}
+
+func insertHistory(ctx context.Context, tx pgx.Tx, e models.HistoryEntry) error {
+	err := updateWithRetry(ctx, tx,
+		`INSERT INTO balance_history (username, kind, amount, reference, comment)
+			VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''))`,
+		e.Username, e.Kind, e.Amount, e.Reference, e.Comment)
+	if err != nil {
+		return fmt.Errorf("cannot insert balance history: %w", err)
+	}
+	return nil
+}
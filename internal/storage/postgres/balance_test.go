@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/history"
+	"github.com/ospiem/gophermart/internal/models/reason"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAdjustBalance leaves its users behind because adjustments are append-only.
+func TestAdjustBalance(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	admin, login := uniqueLogin("adjust_admin"), uniqueLogin("adjust_user")
+	seedUser(t, db, admin, 0)
+	seedUser(t, db, login, 10)
+	cleanupUsers(t, db, admin, login)
+
+	tests := []struct {
+		wantErr     error
+		name        string
+		amount      float32
+		wantBalance float32
+		wantRows    int
+	}{
+		{name: "credit", amount: 50, wantBalance: 60, wantRows: 1},
+		{name: "debit below zero", amount: -100, wantErr: models.ErrInsufficientBalance, wantBalance: 60, wantRows: 1},
+		{name: "debit to zero", amount: -60, wantBalance: 0, wantRows: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adj, err := db.AdjustBalance(ctx, models.Adjustment{
+				Username:   login,
+				Amount:     tt.amount,
+				ReasonCode: reason.Goodwill,
+				Comment:    tt.name,
+				Admin:      admin,
+			})
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			} else {
+				require.NoError(t, err)
+				assert.NotEmpty(t, adj.ID)
+			}
+
+			b, err := db.SelectUserBalance(ctx, login)
+			require.NoError(t, err)
+			assert.InDelta(t, tt.wantBalance, b.Balance, 0.001)
+
+			adjustments, err := db.SelectAdjustments(ctx, login)
+			require.NoError(t, err)
+			assert.Len(t, adjustments, tt.wantRows)
+
+			entries, err := db.SelectBalanceHistory(ctx, login)
+			require.NoError(t, err)
+			require.Len(t, entries, tt.wantRows)
+			if tt.wantErr == nil {
+				assert.Equal(t, history.Adjustment, entries[0].Kind)
+				assert.Equal(t, reason.Goodwill, entries[0].Reference)
+				assert.Equal(t, tt.name, entries[0].Comment)
+				assert.InDelta(t, tt.amount, entries[0].Amount, 0.001)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/campaign"
+)
+
+const campaignColumns = `id, name, starts_at, ends_at, multiplier, flat_bonus, COALESCE(tier, ''),
+	COALESCE(order_prefix, ''), created_by, created_at`
+
+func (db *DB) InsertCampaign(ctx context.Context, c models.Campaign, rec models.AuditRecord) (models.Campaign, error) {
+	if c.Multiplier == 0 {
+		c.Multiplier = 1
+	}
+	err := db.withTx(ctx, "InsertCampaign", func(tx pgx.Tx) error {
+		row := tx.QueryRow(ctx,
+			`INSERT INTO campaigns (name, starts_at, ends_at, multiplier, flat_bonus, tier, order_prefix, created_by)
+				VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8) RETURNING id, created_at`,
+			c.Name, c.StartsAt, c.EndsAt, c.Multiplier, c.FlatBonus, c.Tier, c.OrderPrefix, c.CreatedBy)
+		if err := row.Scan(&c.ID, &c.CreatedAt); err != nil {
+			return fmt.Errorf("cannot insert campaign: %w", err)
+		}
+		rec.Target = c.ID
+		return insertAuditRecord(ctx, tx, rec)
+	})
+	if err != nil {
+		return models.Campaign{}, err
+	}
+	return c, nil
+}
+
+func (db *DB) SelectCampaigns(ctx context.Context) ([]models.Campaign, error) {
+	rows, err := db.pool.Query(ctx, `SELECT `+campaignColumns+` FROM campaigns ORDER BY starts_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select campaigns: %w", err)
+	}
+	campaigns, err := pgx.CollectRows(rows, scanCampaign)
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan campaigns: %w", err)
+	}
+	return campaigns, nil
+}
+
+// EndCampaign stops a campaign that has not ended yet. It returns
+// pgx.ErrNoRows when there is no such campaign.
+func (db *DB) EndCampaign(ctx context.Context, id string, rec models.AuditRecord) error {
+	return db.withTx(ctx, "EndCampaign", func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE campaigns SET ends_at = GREATEST(now(), starts_at + interval '1 microsecond')
+				WHERE id = $1 AND ends_at > now()`, id)
+		if err != nil {
+			return fmt.Errorf("cannot end campaign: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("cannot end campaign: %w", pgx.ErrNoRows)
+		}
+		return insertAuditRecord(ctx, tx, rec)
+	})
+}
+
+// applyCampaigns records the bonus of every campaign running now that targets
+// the order and returns their sum. Bonuses of overlapping campaigns add up and
+// are computed on the base accrual only.
+func applyCampaigns(ctx context.Context, tx pgx.Tx, order models.Order) (float32, error) {
+	rows, err := tx.Query(ctx,
+		`SELECT c.id, c.multiplier, c.flat_bonus FROM campaigns c, users u
+			WHERE u.login = $1 AND now() >= c.starts_at AND now() < c.ends_at
+				AND (c.tier IS NULL OR c.tier = u.tier)
+				AND (c.order_prefix IS NULL OR starts_with($2, c.order_prefix))`,
+		order.Username, order.ID)
+	if err != nil {
+		return 0, fmt.Errorf("cannot select campaigns: %w", err)
+	}
+	type match struct {
+		ID         string
+		Multiplier float32
+		FlatBonus  float32
+	}
+	matches, err := pgx.CollectRows(rows, pgx.RowToStructByPos[match])
+	if err != nil {
+		return 0, fmt.Errorf("cannot scan campaigns: %w", err)
+	}
+
+	var total float32
+	for _, m := range matches {
+		bonus := campaign.Bonus(order.Accrual, m.Multiplier, m.FlatBonus)
+		err := updateWithRetry(ctx, tx,
+			`INSERT INTO order_campaigns (order_id, campaign_id, bonus) VALUES ($1, $2, $3)`,
+			order.ID, m.ID, bonus)
+		if err != nil {
+			return 0, fmt.Errorf("cannot insert order campaign: %w", err)
+		}
+		total += bonus
+	}
+	return total, nil
+}
+
+func scanCampaign(row pgx.CollectableRow) (models.Campaign, error) {
+	c := models.Campaign{}
+	err := row.Scan(&c.ID, &c.Name, &c.StartsAt, &c.EndsAt, &c.Multiplier, &c.FlatBonus, &c.Tier,
+		&c.OrderPrefix, &c.CreatedBy, &c.CreatedAt)
+	return c, err
+}
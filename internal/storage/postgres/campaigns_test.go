@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/status"
+	"github.com/ospiem/gophermart/internal/models/tier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyCampaigns(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	admin, login := uniqueLogin("campaign_admin"), uniqueLogin("campaign_user")
+	seedUser(t, db, admin, 0)
+	seedUser(t, db, login, 0)
+	cleanupUsers(t, db, admin, login)
+
+	// Every campaign targets a fresh prefix so that campaigns of other tests do not match.
+	prefix := uniqueOrder()
+	now := time.Now()
+	running := models.Campaign{StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour), OrderPrefix: prefix}
+	for _, c := range []struct {
+		modify func(c *models.Campaign)
+		name   string
+	}{
+		{name: "double", modify: func(c *models.Campaign) { c.Multiplier = 2 }},
+		{name: "flat", modify: func(c *models.Campaign) { c.FlatBonus = 5 }},
+		{name: "silver only", modify: func(c *models.Campaign) { c.FlatBonus, c.Tier = 1000, tier.Silver }},
+		{name: "ended", modify: func(c *models.Campaign) { c.Multiplier, c.EndsAt = 10, now.Add(-time.Minute) }},
+		{name: "upcoming", modify: func(c *models.Campaign) { c.Multiplier, c.StartsAt = 10, now.Add(time.Hour) }},
+		{name: "other prefix", modify: func(c *models.Campaign) { c.Multiplier, c.OrderPrefix = 10, prefix+"2" }},
+	} {
+		campaign := running
+		campaign.Name = c.name
+		campaign.CreatedBy = admin
+		c.modify(&campaign)
+		_, err := db.InsertCampaign(ctx, campaign, models.AuditRecord{Admin: admin, Action: "create_campaign",
+			Reason: "test"})
+		require.NoError(t, err)
+	}
+
+	order := models.Order{ID: prefix + "1", Status: status.PROCESSED, Username: login, Accrual: 100}
+	require.NoError(t, db.InsertOrder(ctx, models.Order{ID: order.ID, Status: status.NEW, Username: login}))
+
+	var bonus float32
+	err := db.withTx(ctx, "applyCampaigns", func(tx pgx.Tx) error {
+		var err error
+		bonus, err = applyCampaigns(ctx, tx, order)
+		return err
+	})
+	require.NoError(t, err)
+	assert.InDelta(t, 105, bonus, 0.001, "overlapping campaigns add up on the base accrual")
+
+	var applied int
+	require.NoError(t, db.pool.QueryRow(ctx, `SELECT COUNT(*) FROM order_campaigns WHERE order_id = $1`, order.ID).
+		Scan(&applied))
+	assert.Equal(t, 2, applied)
+}
@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/fraud"
+)
+
+// SetFraudThresholds sets when upload signals flag a user. It is safe to call
+// while the DB is in use.
+func (db *DB) SetFraudThresholds(t fraud.Thresholds) {
+	db.settingsMu.Lock()
+	defer db.settingsMu.Unlock()
+	db.fraud = t
+}
+
+func (db *DB) fraudThresholds() fraud.Thresholds {
+	db.settingsMu.RLock()
+	defer db.settingsMu.RUnlock()
+	return db.fraud
+}
+
+// RecordSignal stores a suspicious upload outcome and flags the user if their
+// signals reach a threshold. It reports whether the user is flagged now.
+func (db *DB) RecordSignal(ctx context.Context, login string, signal fraud.Signal, orderID string) (bool, error) {
+	var flagged bool
+	err := db.withTx(ctx, "RecordSignal", func(tx pgx.Tx) error {
+		var err error
+		flagged, err = db.recordSignal(ctx, tx, login, signal, orderID)
+		return err
+	})
+	return flagged, err
+}
+
+// recordSignal counts only signals after the user's last cleared flag, so that
+// clearing a flag gives the user a fresh start.
+func (db *DB) recordSignal(ctx context.Context, tx pgx.Tx, login string, signal fraud.Signal,
+	orderID string) (bool, error) {
+	err := updateWithRetry(ctx, tx,
+		`INSERT INTO upload_signals (username, kind, order_id) VALUES ($1, $2, NULLIF($3, ''))`,
+		login, signal, orderID)
+	if err != nil {
+		return false, fmt.Errorf("cannot insert upload signal: %w", err)
+	}
+
+	thresholds := db.fraudThresholds()
+	c := fraud.Counts{}
+	row := tx.QueryRow(ctx,
+		`SELECT COUNT(*) FILTER (WHERE kind = $3), COUNT(*) FILTER (WHERE kind = $4),
+				COUNT(*) FILTER (WHERE kind = $5)
+			FROM upload_signals WHERE username = $1 AND created_at >= now() - $2::interval
+				AND created_at > COALESCE((SELECT MAX(cleared_at) FROM fraud_flags WHERE username = $1), '-infinity')`,
+		login, thresholds.Window, fraud.InvalidNumber, fraud.Conflict, fraud.AccrualInvalid)
+	if err := row.Scan(&c.InvalidNumber, &c.Conflict, &c.AccrualInvalid); err != nil {
+		return false, fmt.Errorf("cannot count upload signals: %w", err)
+	}
+	reasons := fraud.Evaluate(thresholds, c)
+	if len(reasons) == 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO fraud_flags (username, invalid_number_count, conflict_count, accrual_invalid_count, reasons)
+			VALUES ($1, $2, $3, $4, $5) ON CONFLICT (username) WHERE cleared_at IS NULL DO NOTHING`,
+		login, c.InvalidNumber, c.Conflict, c.AccrualInvalid, reasons)
+	if err != nil {
+		return false, fmt.Errorf("cannot insert fraud flag: %w", err)
+	}
+	return true, nil
+}
+
+func (db *DB) IsFlagged(ctx context.Context, login string) (bool, error) {
+	var flagged bool
+	row := db.pool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM fraud_flags WHERE username = $1 AND cleared_at IS NULL)`, login)
+	if err := row.Scan(&flagged); err != nil {
+		return false, fmt.Errorf("cannot check fraud flag: %w", err)
+	}
+	return flagged, nil
+}
+
+func (db *DB) SelectFraudFlags(ctx context.Context, limit int) ([]models.FraudFlag, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT flagged_at, username, reasons, invalid_number_count, conflict_count, accrual_invalid_count
+			FROM fraud_flags WHERE cleared_at IS NULL ORDER BY flagged_at DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select fraud flags: %w", err)
+	}
+	flags, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.FraudFlag, error) {
+		f := models.FraudFlag{}
+		err := row.Scan(&f.FlaggedAt, &f.Login, &f.Reasons, &f.Signals.InvalidNumber, &f.Signals.Conflict,
+			&f.Signals.AccrualInvalid)
+		return f, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan fraud flags: %w", err)
+	}
+	return flags, nil
+}
+
+// ClearFraudFlag lifts the user's active flag. It returns pgx.ErrNoRows when
+// the user is not flagged.
+func (db *DB) ClearFraudFlag(ctx context.Context, login string, rec models.AuditRecord) error {
+	return db.withTx(ctx, "ClearFraudFlag", func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE fraud_flags SET cleared_at = now(), cleared_by = $1 WHERE username = $2 AND cleared_at IS NULL`,
+			rec.Admin, login)
+		if err != nil {
+			return fmt.Errorf("cannot clear fraud flag: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("cannot clear fraud flag: %w", pgx.ErrNoRows)
+		}
+		return insertAuditRecord(ctx, tx, rec)
+	})
+}
+
+// recordAccrualInvalid records the signal for the owner of an order the
+// accrual system rejected.
+func (db *DB) recordAccrualInvalid(ctx context.Context, tx pgx.Tx, orderID string) error {
+	var login string
+	row := tx.QueryRow(ctx, `SELECT username FROM orders WHERE id = $1`, orderID)
+	if err := row.Scan(&login); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("cannot select order owner: %w", err)
+	}
+	_, err := db.recordSignal(ctx, tx, login, fraud.AccrualInvalid, orderID)
+	return err
+}
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/fraud"
+	"github.com/ospiem/gophermart/internal/models/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordSignal(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	db.SetFraudThresholds(fraud.Thresholds{Window: time.Hour, InvalidNumber: 3, Conflict: 2})
+	admin, login := uniqueLogin("fraud_admin"), uniqueLogin("fraud_user")
+	seedUser(t, db, admin, 0)
+	seedUser(t, db, login, 0)
+	cleanupUsers(t, db, admin, login)
+
+	record := func(signal fraud.Signal, wantFlagged bool) {
+		t.Helper()
+		flagged, err := db.RecordSignal(ctx, login, signal, "")
+		require.NoError(t, err)
+		assert.Equal(t, wantFlagged, flagged)
+		flagged, err = db.IsFlagged(ctx, login)
+		require.NoError(t, err)
+		assert.Equal(t, wantFlagged, flagged)
+	}
+
+	record(fraud.InvalidNumber, false)
+	record(fraud.Conflict, false)
+	record(fraud.InvalidNumber, false)
+	record(fraud.InvalidNumber, true)
+
+	rec := models.AuditRecord{Admin: admin, Action: "clear_fraud_flag", Target: login, Reason: "false positive"}
+	require.NoError(t, db.ClearFraudFlag(ctx, login, rec))
+	flagged, err := db.IsFlagged(ctx, login)
+	require.NoError(t, err)
+	assert.False(t, flagged)
+
+	// Signals before the cleared flag no longer count.
+	record(fraud.InvalidNumber, false)
+	record(fraud.Conflict, false)
+
+	// Neither do signals outside the window.
+	_, err = db.pool.Exec(ctx,
+		`UPDATE upload_signals SET created_at = created_at - interval '2 hours' WHERE username = $1`, login)
+	require.NoError(t, err)
+	record(fraud.Conflict, false)
+	record(fraud.Conflict, true)
+}
+
+func TestAccrualInvalidSignal(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	db.SetFraudThresholds(fraud.Thresholds{Window: time.Hour, AccrualInvalid: 2})
+	login := uniqueLogin("fraud_accrual")
+	seedUser(t, db, login, 0)
+	cleanupUsers(t, db, login)
+
+	for i, want := range []bool{false, true} {
+		id := uniqueOrder()
+		require.NoError(t, db.InsertOrder(ctx, models.Order{ID: id, Status: status.NEW, Username: login}))
+		require.NoError(t, db.ProcessOrderWithBonuses(ctx, models.Order{ID: id, Status: status.INVALID}))
+		flagged, err := db.IsFlagged(ctx, login)
+		require.NoError(t, err)
+		assert.Equal(t, want, flagged, "after %d rejected orders", i+1)
+	}
+}
@@ -0,0 +1,291 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/history"
+	"github.com/ospiem/gophermart/internal/models/hold"
+	"github.com/ospiem/gophermart/internal/models/status"
+)
+
+const holdColumns = `id, order_number, amount, status, created_at, expires_at, lots_expire_at`
+
+func scanHold(row pgx.Row, login string) (models.Hold, error) {
+	h := models.Hold{Username: login}
+	err := row.Scan(&h.ID, &h.OrderNumber, &h.Sum, &h.Status, &h.CreatedAt, &h.ExpiresAt, &h.LotsExpireAt)
+	if err != nil {
+		return models.Hold{}, fmt.Errorf("cannot scan hold: %w", err)
+	}
+	return h, nil
+}
+
+// CreateHold reserves h.Sum points of the user for h.TTL. Reserved
+// points leave the available balance right away. The hold is HELD unless
+// h.Status asks for hold.PENDING, which waits for an admin instead of the user.
+// It returns models.ErrOrderOfAnotherUser or models.ErrOrderInUse when the order
+// number is already taken by an order or an active hold.
+func (db *DB) CreateHold(ctx context.Context, h models.Hold) (models.Hold, error) {
+	err := db.withTx(ctx, "CreateHold", func(tx pgx.Tx) error {
+		var balance, debt float32
+		row := tx.QueryRow(ctx,
+			`SELECT COALESCE(balance, 0), points_debt FROM users WHERE login = $1 FOR UPDATE`, h.Username)
+		if err := row.Scan(&balance, &debt); err != nil {
+			return fmt.Errorf("cannot lock user's balance: %w", err)
+		}
+		if debt > 0 {
+			return models.ErrWithdrawalsBlocked
+		}
+		if balance < h.Sum {
+			return models.ErrInsufficientBalance
+		}
+		if err := checkOrderNumberFree(ctx, tx, h.Username, h.OrderNumber); err != nil {
+			return err
+		}
+		if err := db.checkWithdrawLimit(ctx, tx, h.Username, h.Sum); err != nil {
+			return err
+		}
+
+		err := updateWithRetry(ctx, tx,
+			`UPDATE users SET balance = COALESCE(balance, 0) - $1, held = held + $1 WHERE login = $2`,
+			h.Sum, h.Username)
+		if err != nil {
+			return fmt.Errorf("cannot update user's balance: %w", err)
+		}
+		if h.LotsExpireAt, err = consumeLots(ctx, tx, h.Username, h.Sum); err != nil {
+			return err
+		}
+
+		if h.Status != hold.PENDING {
+			h.Status = hold.HELD
+		}
+		row = tx.QueryRow(ctx,
+			`INSERT INTO balance_holds (username, order_number, amount, status, expires_at, lots_expire_at)
+				VALUES ($1, $2, $3, $4, now() + $5::interval, $6) RETURNING id, created_at, expires_at`,
+			h.Username, h.OrderNumber, h.Sum, h.Status, h.TTL, h.LotsExpireAt)
+		if err := row.Scan(&h.ID, &h.CreatedAt, &h.ExpiresAt); err != nil {
+			return fmt.Errorf("cannot insert hold: %w", err)
+		}
+
+		return insertHistory(ctx, tx, models.HistoryEntry{
+			Username:  h.Username,
+			Kind:      history.Hold,
+			Amount:    -h.Sum,
+			Reference: h.OrderNumber,
+		})
+	})
+	if err != nil {
+		return models.Hold{}, err
+	}
+	return h, nil
+}
+
+// ConfirmHold turns an active hold into a withdrawal. It returns pgx.ErrNoRows
+// when the user has no active hold with the given id.
+func (db *DB) ConfirmHold(ctx context.Context, login string, id string) (models.Hold, error) {
+	var h models.Hold
+	err := db.withTx(ctx, "ConfirmHold", func(tx pgx.Tx) error {
+		var err error
+		if h, err = lockHold(ctx, tx, login, id, hold.HELD, false); err != nil {
+			return err
+		}
+		h.Status = hold.CONFIRMED
+		return confirmHold(ctx, tx, h)
+	})
+	if err != nil {
+		return models.Hold{}, err
+	}
+	return h, nil
+}
+
+func confirmHold(ctx context.Context, tx pgx.Tx, h models.Hold) error {
+	err := updateWithRetry(ctx, tx,
+		`UPDATE users SET held = held - $1, total_withdrawn = COALESCE(total_withdrawn, 0) + $1
+			WHERE login = $2`, h.Sum, h.Username)
+	if err != nil {
+		return fmt.Errorf("cannot update user's balance: %w", err)
+	}
+
+	// CreateHold checked the order number, but an order may have been uploaded
+	// with it since. The withdrawal must not be attached to that order.
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO orders (id, status, username) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+		h.OrderNumber, status.NEW, h.Username)
+	if err != nil {
+		return fmt.Errorf("cannot insert order: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("cannot insert order %s: %w", h.OrderNumber, models.ErrOrderInUse)
+	}
+	var wID string
+	row := tx.QueryRow(ctx,
+		`INSERT INTO withdraws (username, withdrawn, order_number) VALUES ($1, $2, $3) RETURNING id`,
+		h.Username, h.Sum, h.OrderNumber)
+	if err := row.Scan(&wID); err != nil {
+		return fmt.Errorf("cannot insert withdraw: %w", err)
+	}
+	if err := updateWithRetry(ctx, tx, `UPDATE orders SET withdraw = $1 WHERE id = $2`,
+		wID, h.OrderNumber); err != nil {
+		return fmt.Errorf("cannot update user's order: %w", err)
+	}
+
+	if err := resolveHold(ctx, tx, h); err != nil {
+		return err
+	}
+	for _, e := range []models.HistoryEntry{
+		{Username: h.Username, Kind: history.HoldRelease, Amount: h.Sum, Reference: h.OrderNumber},
+		{Username: h.Username, Kind: history.Withdrawal, Amount: -h.Sum, Reference: h.OrderNumber},
+	} {
+		if err := insertHistory(ctx, tx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkOrderNumberFree fails if the order number belongs to an order or to an
+// active hold, reporting another user's before the user's own.
+func checkOrderNumberFree(ctx context.Context, tx pgx.Tx, login string, number string) error {
+	var owner string
+	row := tx.QueryRow(ctx,
+		`SELECT username FROM (
+			SELECT username FROM orders WHERE id = $1
+			UNION ALL
+			SELECT username FROM balance_holds WHERE order_number = $1 AND status IN ($3, $4)
+		) owners ORDER BY username = $2 LIMIT 1`,
+		number, login, hold.HELD, hold.PENDING)
+	if err := row.Scan(&owner); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("cannot check order number: %w", err)
+	}
+	if owner != login {
+		return models.ErrOrderOfAnotherUser
+	}
+	return models.ErrOrderInUse
+}
+
+// CancelHold releases an active hold. It returns pgx.ErrNoRows when the user
+// has no active hold with the given id.
+func (db *DB) CancelHold(ctx context.Context, login string, id string) (models.Hold, error) {
+	var h models.Hold
+	err := db.withTx(ctx, "CancelHold", func(tx pgx.Tx) error {
+		var err error
+		if h, err = lockHold(ctx, tx, login, id, hold.HELD, false); err != nil {
+			return err
+		}
+		h.Status = hold.CANCELLED
+		return releaseHold(ctx, tx, h)
+	})
+	if err != nil {
+		return models.Hold{}, err
+	}
+	return h, nil
+}
+
+// ExpireHolds releases holds that were neither confirmed nor cancelled in time,
+// including withdrawals no admin approved, and returns how many were released.
+func (db *DB) ExpireHolds(ctx context.Context) (int, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT id, username, status FROM balance_holds
+			WHERE status IN ($1, $2) AND expires_at <= now() LIMIT $3`,
+		hold.HELD, hold.PENDING, expiryBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("cannot select expired holds: %w", err)
+	}
+	type expired struct {
+		ID       string
+		Username string
+		Status   hold.Status
+	}
+	holds, err := pgx.CollectRows(rows, pgx.RowToStructByPos[expired])
+	if err != nil {
+		return 0, fmt.Errorf("cannot scan expired holds: %w", err)
+	}
+
+	for _, e := range holds {
+		err := db.withTx(ctx, "ExpireHolds", func(tx pgx.Tx) error {
+			h, err := lockHold(ctx, tx, e.Username, e.ID, e.Status, true)
+			if err != nil {
+				return err
+			}
+			h.Status = hold.EXPIRED
+			return releaseHold(ctx, tx, h)
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(holds), nil
+}
+
+func (db *DB) SelectHolds(ctx context.Context, login string) ([]models.Hold, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT `+holdColumns+` FROM balance_holds WHERE username = $1 ORDER BY created_at DESC`, login)
+	if err != nil {
+		return nil, fmt.Errorf("postgres failed to get holds: %w", err)
+	}
+	defer rows.Close()
+
+	holds := make([]models.Hold, 0)
+	for rows.Next() {
+		h, err := scanHold(rows, login)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, h)
+	}
+	return holds, nil
+}
+
+// lockHold locks the user and their hold with status st, in this order. The
+// hold must be unexpired unless expired is set, in which case it must be overdue.
+func lockHold(ctx context.Context, tx pgx.Tx, login string, id string, st hold.Status,
+	expired bool) (models.Hold, error) {
+	if _, err := lockUserBalance(ctx, tx, login); err != nil {
+		return models.Hold{}, err
+	}
+	query := `SELECT ` + holdColumns + ` FROM balance_holds
+		WHERE id::text = $1 AND username = $2 AND status = $3 AND expires_at > now() FOR UPDATE`
+	if expired {
+		query = `SELECT ` + holdColumns + ` FROM balance_holds
+			WHERE id::text = $1 AND username = $2 AND status = $3 AND expires_at <= now() FOR UPDATE`
+	}
+	return scanHold(tx.QueryRow(ctx, query, id, login, st), login)
+}
+
+// releaseHold returns held points to the available balance. They keep the
+// earliest expiry of the lots they were taken from.
+func releaseHold(ctx context.Context, tx pgx.Tx, h models.Hold) error {
+	err := updateWithRetry(ctx, tx,
+		`UPDATE users SET balance = COALESCE(balance, 0) + $1, held = held - $1 WHERE login = $2`,
+		h.Sum, h.Username)
+	if err != nil {
+		return fmt.Errorf("cannot update user's balance: %w", err)
+	}
+	if err := insertLot(ctx, tx, h.Username, h.Sum, h.OrderNumber, h.LotsExpireAt); err != nil {
+		return err
+	}
+	if err := resolveHold(ctx, tx, h); err != nil {
+		return err
+	}
+	return insertHistory(ctx, tx, models.HistoryEntry{
+		Username:  h.Username,
+		Kind:      history.HoldRelease,
+		Amount:    h.Sum,
+		Reference: h.OrderNumber,
+	})
+}
+
+func resolveHold(ctx context.Context, tx pgx.Tx, h models.Hold) error {
+	err := updateWithRetry(ctx, tx, `UPDATE balance_holds SET status = $1, resolved_at = now() WHERE id = $2`,
+		h.Status, h.ID)
+	if err != nil {
+		return fmt.Errorf("cannot resolve hold: %w", err)
+	}
+	return nil
+}
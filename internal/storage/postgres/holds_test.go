@@ -0,0 +1,200 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/hold"
+	"github.com/ospiem/gophermart/internal/models/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var orderSeq atomic.Int64
+
+// uniqueOrder returns an order number no earlier run has used.
+func uniqueOrder() string {
+	return fmt.Sprintf("%d%03d", time.Now().UnixNano(), orderSeq.Add(1)%1000)
+}
+
+func assertBalance(t *testing.T, db *DB, login string, balance, held, withdrawn float32) {
+	t.Helper()
+	b, err := db.SelectUserBalance(context.Background(), login)
+	require.NoError(t, err)
+	assert.InDelta(t, balance, b.Balance, 0.001, "available")
+	assert.InDelta(t, held, b.Held, 0.001, "held")
+	assert.InDelta(t, withdrawn, b.Withdrawn, 0.001, "withdrawn")
+}
+
+func createHold(t *testing.T, db *DB, login string, order string, sum float32, ttl time.Duration) models.Hold {
+	t.Helper()
+	h, err := db.CreateHold(context.Background(), models.Hold{
+		Username:    login,
+		OrderNumber: order,
+		Sum:         sum,
+		TTL:         ttl,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, hold.HELD, h.Status)
+	assert.WithinDuration(t, h.CreatedAt.Add(ttl), h.ExpiresAt, time.Second, "the database sets the expiry")
+	return h
+}
+
+func TestHoldLifecycle(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	login := uniqueLogin("hold_test")
+	seedUser(t, db, login, 100)
+	cleanupUsers(t, db, login)
+
+	confirmed := createHold(t, db, login, uniqueOrder(), 30, time.Hour)
+	assertBalance(t, db, login, 70, 30, 0)
+	cancelled := createHold(t, db, login, uniqueOrder(), 20, time.Hour)
+	assertBalance(t, db, login, 50, 50, 0)
+
+	withdraws, err := db.SelectWithdraws(ctx, login)
+	require.NoError(t, err)
+	assert.Empty(t, withdraws, "held points are not withdrawn yet")
+
+	h, err := db.ConfirmHold(ctx, login, confirmed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, hold.CONFIRMED, h.Status)
+	assertBalance(t, db, login, 50, 20, 30)
+
+	h, err = db.CancelHold(ctx, login, cancelled.ID)
+	require.NoError(t, err)
+	assert.Equal(t, hold.CANCELLED, h.Status)
+	assertBalance(t, db, login, 70, 0, 30)
+
+	withdraws, err = db.SelectWithdraws(ctx, login)
+	require.NoError(t, err)
+	require.Len(t, withdraws, 1, "only confirmed holds are withdrawals")
+	assert.Equal(t, confirmed.OrderNumber, withdraws[0].Order)
+	assert.InDelta(t, 30, withdraws[0].Sum, 0.001)
+
+	tests := []struct {
+		resolve func(ctx context.Context, login string, id string) (models.Hold, error)
+		name    string
+		id      string
+	}{
+		{name: "confirm a cancelled hold", resolve: db.ConfirmHold, id: cancelled.ID},
+		{name: "cancel a confirmed hold", resolve: db.CancelHold, id: confirmed.ID},
+		{name: "confirm another user's hold", id: confirmed.ID,
+			resolve: func(ctx context.Context, _ string, id string) (models.Hold, error) {
+				return db.ConfirmHold(ctx, login+"_other", id)
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.resolve(ctx, login, tt.id)
+			assert.True(t, errors.Is(err, pgx.ErrNoRows), "got %v", err)
+			assertBalance(t, db, login, 70, 0, 30)
+		})
+	}
+
+	_, err = db.CreateHold(ctx, models.Hold{Username: login, OrderNumber: uniqueOrder(), Sum: 71,
+		TTL: time.Hour})
+	assert.True(t, errors.Is(err, models.ErrInsufficientBalance), "got %v", err)
+	assertBalance(t, db, login, 70, 0, 30)
+}
+
+func TestExpireHolds(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	login := uniqueLogin("hold_expiry_test")
+	seedUser(t, db, login, 100)
+	cleanupUsers(t, db, login)
+
+	overdue := createHold(t, db, login, uniqueOrder(), 40, -time.Minute)
+	active := createHold(t, db, login, uniqueOrder(), 10, time.Hour)
+	assertBalance(t, db, login, 50, 50, 0)
+
+	_, err := db.ConfirmHold(ctx, login, overdue.ID)
+	assert.True(t, errors.Is(err, pgx.ErrNoRows), "an overdue hold cannot be confirmed, got %v", err)
+
+	for i := 0; i < 10; i++ {
+		n, err := db.ExpireHolds(ctx)
+		require.NoError(t, err)
+		if n == 0 {
+			break
+		}
+	}
+	assertBalance(t, db, login, 90, 10, 0)
+
+	holds, err := db.SelectHolds(ctx, login)
+	require.NoError(t, err)
+	statuses := make(map[string]string, len(holds))
+	for _, h := range holds {
+		statuses[h.ID] = h.Status
+	}
+	assert.Equal(t, map[string]string{overdue.ID: hold.EXPIRED, active.ID: hold.HELD}, statuses)
+
+	withdraws, err := db.SelectWithdraws(ctx, login)
+	require.NoError(t, err)
+	assert.Empty(t, withdraws)
+}
+
+func TestCreateHoldOrderNumberInUse(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	alice, bob := uniqueLogin("hold_alice"), uniqueLogin("hold_bob")
+	seedUser(t, db, alice, 100)
+	seedUser(t, db, bob, 100)
+	cleanupUsers(t, db, alice, bob)
+
+	uploaded := uniqueOrder()
+	require.NoError(t, db.InsertOrder(ctx, models.Order{ID: uploaded, Status: status.NEW, Username: alice}))
+	held := createHold(t, db, alice, uniqueOrder(), 10, time.Hour)
+
+	tests := []struct {
+		wantErr error
+		name    string
+		login   string
+		order   string
+	}{
+		{name: "another user's order", login: bob, order: uploaded, wantErr: models.ErrOrderOfAnotherUser},
+		{name: "own order", login: alice, order: uploaded, wantErr: models.ErrOrderInUse},
+		{name: "another user's hold", login: bob, order: held.OrderNumber, wantErr: models.ErrOrderOfAnotherUser},
+		{name: "own hold", login: alice, order: held.OrderNumber, wantErr: models.ErrOrderInUse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.CreateHold(ctx, models.Hold{Username: tt.login, OrderNumber: tt.order, Sum: 5,
+				TTL: time.Hour})
+			assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+		})
+	}
+	assertBalance(t, db, alice, 90, 10, 0)
+	assertBalance(t, db, bob, 100, 0, 0)
+}
+
+func TestConfirmHoldOrderTakenMeanwhile(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	alice, bob := uniqueLogin("confirm_alice"), uniqueLogin("confirm_bob")
+	seedUser(t, db, alice, 100)
+	seedUser(t, db, bob, 0)
+	cleanupUsers(t, db, alice, bob)
+
+	h := createHold(t, db, alice, uniqueOrder(), 30, time.Hour)
+	require.NoError(t, db.InsertOrder(ctx, models.Order{ID: h.OrderNumber, Status: status.NEW, Username: bob}))
+
+	_, err := db.ConfirmHold(ctx, alice, h.ID)
+	assert.True(t, errors.Is(err, models.ErrOrderInUse), "got %v", err)
+	assertBalance(t, db, alice, 70, 30, 0)
+
+	var withdraw *string
+	require.NoError(t, db.pool.QueryRow(ctx, `SELECT withdraw FROM orders WHERE id = $1`, h.OrderNumber).
+		Scan(&withdraw))
+	assert.Nil(t, withdraw, "the withdrawal must not be attached to another user's order")
+
+	_, err = db.CancelHold(ctx, alice, h.ID)
+	require.NoError(t, err, "the hold stays active and can be cancelled")
+	assertBalance(t, db, alice, 100, 0, 0)
+}
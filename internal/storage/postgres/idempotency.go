@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ospiem/gophermart/internal/models"
+)
+
+// ReserveIdempotencyKey claims the user's key for a new request. If the key is
+// already taken and has not expired, it returns the stored response and false.
+func (db *DB) ReserveIdempotencyKey(ctx context.Context,
+	res models.IdempotentResponse) (models.IdempotentResponse, bool, error) {
+	tag, err := db.pool.Exec(ctx,
+		`INSERT INTO idempotency_keys (username, key, request_hash, expires_at)
+			VALUES ($1, $2, $3, now() + $4::interval)
+			ON CONFLICT (username, key) DO UPDATE
+				SET request_hash = EXCLUDED.request_hash, expires_at = EXCLUDED.expires_at, created_at = now(),
+					status_code = NULL, content_type = NULL, body = NULL
+				WHERE idempotency_keys.expires_at <= now()`,
+		res.Username, res.Key, res.RequestHash, res.TTL)
+	if err != nil {
+		return models.IdempotentResponse{}, false, fmt.Errorf("cannot reserve idempotency key: %w", err)
+	}
+	if tag.RowsAffected() == 1 {
+		return res, true, nil
+	}
+
+	stored := models.IdempotentResponse{Username: res.Username, Key: res.Key}
+	var statusCode *int
+	var contentType *string
+	row := db.pool.QueryRow(ctx,
+		`SELECT request_hash, status_code, content_type, body FROM idempotency_keys
+			WHERE username = $1 AND key = $2`, res.Username, res.Key)
+	if err := row.Scan(&stored.RequestHash, &statusCode, &contentType, &stored.Body); err != nil {
+		return models.IdempotentResponse{}, false, fmt.Errorf("cannot select idempotency key: %w", err)
+	}
+	if statusCode != nil {
+		stored.StatusCode = *statusCode
+	}
+	if contentType != nil {
+		stored.ContentType = *contentType
+	}
+	return stored, false, nil
+}
+
+func (db *DB) SaveIdempotentResponse(ctx context.Context, res models.IdempotentResponse) error {
+	_, err := db.pool.Exec(ctx,
+		`UPDATE idempotency_keys SET status_code = $1, content_type = $2, body = $3
+			WHERE username = $4 AND key = $5`,
+		res.StatusCode, res.ContentType, res.Body, res.Username, res.Key)
+	if err != nil {
+		return fmt.Errorf("cannot save idempotent response: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) DeleteIdempotencyKey(ctx context.Context, login string, key string) error {
+	_, err := db.pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE username = $1 AND key = $2`, login, key)
+	if err != nil {
+		return fmt.Errorf("cannot delete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes a batch of expired keys and returns how many were removed.
+func (db *DB) DeleteExpiredIdempotencyKeys(ctx context.Context) (int, error) {
+	tag, err := db.pool.Exec(ctx,
+		`DELETE FROM idempotency_keys WHERE ctid IN (
+			SELECT ctid FROM idempotency_keys WHERE expires_at <= now() LIMIT $1)`, expiryBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("cannot delete expired idempotency keys: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
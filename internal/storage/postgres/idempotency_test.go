@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReserveIdempotencyKey(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	login := uniqueLogin("idempotency_test")
+	seedUser(t, db, login, 0)
+	cleanupUsers(t, db, login)
+
+	reserve := func(key string, ttl time.Duration) bool {
+		t.Helper()
+		_, reserved, err := db.ReserveIdempotencyKey(ctx, models.IdempotentResponse{Username: login, Key: key,
+			RequestHash: "hash", TTL: ttl})
+		require.NoError(t, err)
+		return reserved
+	}
+
+	assert.True(t, reserve("live", time.Hour))
+	assert.False(t, reserve("live", time.Hour), "a live key stays taken")
+
+	assert.True(t, reserve("expired", -time.Minute))
+	assert.True(t, reserve("expired", time.Hour), "an expired key can be reserved again")
+}
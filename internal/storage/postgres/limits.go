@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models/hold"
+	"github.com/ospiem/gophermart/internal/models/limit"
+	"github.com/ospiem/gophermart/internal/models/tier"
+)
+
+// SetWithdrawLimits sets the limits checked before every withdrawal and hold.
+// It is safe to call while the DB is in use.
+func (db *DB) SetWithdrawLimits(l limit.Limits) {
+	db.settingsMu.Lock()
+	defer db.settingsMu.Unlock()
+	db.limits = l
+}
+
+func (db *DB) withdrawLimits() limit.Limits {
+	db.settingsMu.RLock()
+	defer db.settingsMu.RUnlock()
+	return db.limits
+}
+
+// checkWithdrawLimit locks the user's row and returns a *limit.Violation if
+// withdrawing sum would break a limit. Active holds count as withdrawn in the
+// day and month they were created in.
+func (db *DB) checkWithdrawLimit(ctx context.Context, tx pgx.Tx, login string, sum float32) error {
+	var t tier.Tier
+	usage := limit.Usage{}
+	row := tx.QueryRow(ctx, `SELECT tier, COALESCE(balance, 0) FROM users WHERE login = $1 FOR UPDATE`, login)
+	if err := row.Scan(&t, &usage.Balance); err != nil {
+		return fmt.Errorf("cannot lock user: %w", err)
+	}
+	limits := db.withdrawLimits()
+	limits.TierDaily = db.tiers.Level(t).Perks.DailyWithdrawLimit
+
+	row = tx.QueryRow(ctx,
+		`SELECT COALESCE(SUM(withdrawn) FILTER (WHERE processed_at >= date_trunc('day', now())), 0),
+				COALESCE(SUM(withdrawn), 0),
+				COUNT(*) FILTER (WHERE processed_at >= date_trunc('day', now()))
+			FROM withdraws WHERE username = $1 AND processed_at >= date_trunc('month', now())`, login)
+	if err := row.Scan(&usage.Today, &usage.Month, &usage.TodayCount); err != nil {
+		return fmt.Errorf("cannot sum withdrawals: %w", err)
+	}
+
+	var heldToday, heldMonth float32
+	var holdsToday int
+	row = tx.QueryRow(ctx,
+		`SELECT COALESCE(SUM(amount) FILTER (WHERE created_at >= date_trunc('day', now())), 0),
+				COALESCE(SUM(amount), 0),
+				COUNT(*) FILTER (WHERE created_at >= date_trunc('day', now()))
+			FROM balance_holds WHERE username = $1 AND status IN ($2, $3)
+				AND created_at >= date_trunc('month', now())`,
+		login, hold.HELD, hold.PENDING)
+	if err := row.Scan(&heldToday, &heldMonth, &holdsToday); err != nil {
+		return fmt.Errorf("cannot sum holds: %w", err)
+	}
+	usage.Today += heldToday
+	usage.Month += heldMonth
+	usage.TodayCount += holdsToday
+
+	return limit.Check(limits, usage, sum)
+}
@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/hold"
+	"github.com/ospiem/gophermart/internal/models/limit"
+	"github.com/ospiem/gophermart/internal/models/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tryHold(db *DB, login string, sum float32) error {
+	_, err := db.CreateHold(context.Background(), models.Hold{Username: login, OrderNumber: uniqueOrder(), Sum: sum,
+		TTL: 24 * time.Hour})
+	return err
+}
+
+func TestCheckWithdrawLimit(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	db.SetWithdrawLimits(limit.Limits{Daily: 100})
+	login := uniqueLogin("limit_test")
+	seedUser(t, db, login, 1000)
+	cleanupUsers(t, db, login)
+
+	require.NoError(t, tryHold(db, login, 60))
+	err := tryHold(db, login, 50)
+	var v *limit.Violation
+	require.True(t, errors.As(err, &v), "got %v", err)
+	assert.Equal(t, limit.Daily, v.Limit)
+	assert.InDelta(t, 40, v.Remaining, 0.001, "active holds count as withdrawn")
+
+	// A hold placed yesterday no longer counts against today's limit.
+	_, err = db.pool.Exec(ctx,
+		`UPDATE balance_holds SET created_at = date_trunc('day', now()) - interval '1 minute' WHERE username = $1`,
+		login)
+	require.NoError(t, err)
+	require.NoError(t, tryHold(db, login, 50))
+
+	order := uniqueOrder()
+	require.NoError(t, db.InsertOrder(ctx, models.Order{ID: order, Status: status.NEW, Username: login}))
+	require.NoError(t, db.InsertWithdraw(ctx, models.Withdraw{OrderNumber: order, User: login, Sum: 40}))
+
+	err = tryHold(db, login, 20)
+	require.True(t, errors.As(err, &v), "got %v", err)
+	assert.Equal(t, limit.Daily, v.Limit)
+	assert.InDelta(t, 10, v.Remaining, 0.001, "today's holds and withdrawals add up")
+	assert.True(t, errors.Is(err, models.ErrWithdrawLimitExceeded))
+}
+
+func TestPendingWithdrawals(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	admin, login := uniqueLogin("approval_admin"), uniqueLogin("approval_user")
+	seedUser(t, db, admin, 0)
+	seedUser(t, db, login, 100)
+	cleanupUsers(t, db, admin, login)
+
+	pending := func(sum float32) models.Hold {
+		h, err := db.CreateHold(ctx, models.Hold{Username: login, OrderNumber: uniqueOrder(), Sum: sum,
+			Status: hold.PENDING, TTL: time.Hour})
+		require.NoError(t, err)
+		assert.Equal(t, hold.PENDING, h.Status)
+		return h
+	}
+	approved, rejected := pending(30), pending(20)
+	held := createHold(t, db, login, uniqueOrder(), 10, time.Hour)
+	assertBalance(t, db, login, 40, 60, 0)
+
+	list, err := db.SelectPendingWithdrawals(ctx, 500)
+	require.NoError(t, err)
+	ids := make(map[string]string)
+	for _, p := range list {
+		if p.Login == login {
+			ids[p.ID] = p.Status
+		}
+	}
+	assert.Equal(t, map[string]string{approved.ID: hold.PENDING, rejected.ID: hold.PENDING}, ids)
+
+	rec := models.AuditRecord{Admin: admin, Action: "approve_withdrawal", Target: approved.ID, Reason: "checked"}
+	h, err := db.ApproveWithdrawal(ctx, approved.ID, rec)
+	require.NoError(t, err)
+	assert.Equal(t, hold.CONFIRMED, h.Status)
+	assertBalance(t, db, login, 40, 30, 30)
+
+	rec = models.AuditRecord{Admin: admin, Action: "reject_withdrawal", Target: rejected.ID, Reason: "suspicious"}
+	h, err = db.RejectWithdrawal(ctx, rejected.ID, rec)
+	require.NoError(t, err)
+	assert.Equal(t, hold.REJECTED, h.Status)
+	assertBalance(t, db, login, 60, 10, 30)
+
+	withdraws, err := db.SelectWithdraws(ctx, login)
+	require.NoError(t, err)
+	require.Len(t, withdraws, 1)
+	assert.Equal(t, approved.OrderNumber, withdraws[0].Order)
+
+	for _, id := range []string{approved.ID, rejected.ID, held.ID} {
+		_, err := db.ApproveWithdrawal(ctx, id, rec)
+		assert.True(t, errors.Is(err, pgx.ErrNoRows), "only pending withdrawals can be resolved, got %v", err)
+	}
+
+	var audited int
+	require.NoError(t, db.pool.QueryRow(ctx, `SELECT COUNT(*) FROM admin_audit WHERE admin = $1`, admin).
+		Scan(&audited))
+	assert.Equal(t, 2, audited)
+}
@@ -0,0 +1,163 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/history"
+)
+
+const expiryBatchSize = 100
+
+// SetPointsExpiry sets how long credited points live. Zero disables expiry.
+func (db *DB) SetPointsExpiry(ttl time.Duration) {
+	db.pointsTTL = ttl
+}
+
+// addLot records credited points as a lot that expires pointsTTL after now.
+// The expiry is computed by the database, the clock ExpireLots compares with.
+func (db *DB) addLot(ctx context.Context, tx pgx.Tx, login string, amount float32, source string) error {
+	if db.pointsTTL <= 0 {
+		return insertLot(ctx, tx, login, amount, source, nil)
+	}
+	if amount <= 0 {
+		return nil
+	}
+	err := updateWithRetry(ctx, tx,
+		`INSERT INTO point_lots (username, source, amount, remaining, expires_at)
+			VALUES ($1, $2, $3, $3, now() + $4::interval)`,
+		login, source, amount, db.pointsTTL)
+	if err != nil {
+		return fmt.Errorf("cannot insert point lot: %w", err)
+	}
+	return nil
+}
+
+func insertLot(ctx context.Context, tx pgx.Tx, login string, amount float32, source string,
+	expiresAt *time.Time) error {
+	if amount <= 0 {
+		return nil
+	}
+	err := updateWithRetry(ctx, tx,
+		`INSERT INTO point_lots (username, source, amount, remaining, expires_at) VALUES ($1, $2, $3, $3, $4)`,
+		login, source, amount, expiresAt)
+	if err != nil {
+		return fmt.Errorf("cannot insert point lot: %w", err)
+	}
+	return nil
+}
+
+// consumeLots takes amount from the user's lots, oldest first, and returns the
+// earliest expiry among the consumed lots. The caller must hold the lock on the
+// user's row. If the lots do not cover amount, all of them are emptied.
+func consumeLots(ctx context.Context, tx pgx.Tx, login string, amount float32) (*time.Time, error) {
+	rows, err := tx.Query(ctx,
+		`WITH ordered AS (
+			SELECT id, remaining,
+				SUM(remaining) OVER (ORDER BY expires_at NULLS LAST, created_at, id) - remaining AS before
+			FROM point_lots WHERE username = $1 AND remaining > 0
+		)
+		UPDATE point_lots p SET remaining = p.remaining - LEAST(o.remaining, $2 - o.before)
+			FROM ordered o WHERE p.id = o.id AND o.before < $2
+			RETURNING p.expires_at`,
+		login, amount)
+	if err != nil {
+		return nil, fmt.Errorf("cannot consume point lots: %w", err)
+	}
+	expiries, err := pgx.CollectRows(rows, pgx.RowTo[*time.Time])
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan consumed lots: %w", err)
+	}
+
+	var earliest *time.Time
+	for _, e := range expiries {
+		if e != nil && (earliest == nil || e.Before(*earliest)) {
+			earliest = e
+		}
+	}
+	return earliest, nil
+}
+
+// ExpireLots debits overdue lots from their owners' balances and returns the
+// number of users affected. Every user is handled in its own transaction.
+func (db *DB) ExpireLots(ctx context.Context) (int, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT DISTINCT username FROM point_lots WHERE expires_at <= now() AND remaining > 0 LIMIT $1`,
+		expiryBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("cannot select users with expired lots: %w", err)
+	}
+	logins, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, fmt.Errorf("cannot scan users with expired lots: %w", err)
+	}
+
+	for _, login := range logins {
+		if err := db.expireUserLots(ctx, login); err != nil {
+			return 0, err
+		}
+	}
+	return len(logins), nil
+}
+
+func (db *DB) expireUserLots(ctx context.Context, login string) error {
+	return db.withTx(ctx, "expireUserLots", func(tx pgx.Tx) error {
+		if _, err := lockUserBalance(ctx, tx, login); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx,
+			`WITH due AS (
+				SELECT id, remaining FROM point_lots
+				WHERE username = $1 AND expires_at <= now() AND remaining > 0 FOR UPDATE
+			)
+			UPDATE point_lots p SET remaining = 0 FROM due WHERE p.id = due.id
+			RETURNING p.id, due.remaining`, login)
+		if err != nil {
+			return fmt.Errorf("cannot expire lots: %w", err)
+		}
+		type expired struct {
+			ID     string
+			Amount float32
+		}
+		lots, err := pgx.CollectRows(rows, pgx.RowToStructByPos[expired])
+		if err != nil {
+			return fmt.Errorf("cannot scan expired lots: %w", err)
+		}
+
+		var total float32
+		for _, lot := range lots {
+			total += lot.Amount
+			err := insertHistory(ctx, tx, models.HistoryEntry{
+				Username:  login,
+				Kind:      history.Expiry,
+				Amount:    -lot.Amount,
+				Reference: lot.ID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		err = updateWithRetry(ctx, tx, `UPDATE users SET balance = COALESCE(balance, 0) - $1 WHERE login = $2`,
+			total, login)
+		if err != nil {
+			return fmt.Errorf("cannot update user's balance: %w", err)
+		}
+		return nil
+	})
+}
+
+// SelectExpiringPoints returns how many of the user's points expire within the given window.
+func (db *DB) SelectExpiringPoints(ctx context.Context, login string, within time.Duration) (float32, error) {
+	var amount float32
+	row := db.pool.QueryRow(ctx,
+		`SELECT COALESCE(SUM(remaining), 0) FROM point_lots
+			WHERE username = $1 AND remaining > 0 AND expires_at <= now() + $2::interval`, login, within)
+	if err := row.Scan(&amount); err != nil {
+		return 0, fmt.Errorf("cannot select expiring points: %w", err)
+	}
+	return amount, nil
+}
@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models/history"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedLots gives the user a balance made of the lots, keyed by source, and
+// returns the lot IDs by source.
+func seedLots(t *testing.T, db *DB, login string, lots map[string]float32,
+	expiry map[string]*time.Time) map[string]string {
+	t.Helper()
+	ctx := context.Background()
+	var total float32
+	err := db.withTx(ctx, "seedLots", func(tx pgx.Tx) error {
+		for source, amount := range lots {
+			total += amount
+			if err := insertLot(ctx, tx, login, amount, source, expiry[source]); err != nil {
+				return err
+			}
+		}
+		return updateWithRetry(ctx, tx, `UPDATE users SET balance = $1 WHERE login = $2`, total, login)
+	})
+	require.NoError(t, err)
+
+	ids := make(map[string]string, len(lots))
+	rows, err := db.pool.Query(ctx, `SELECT source, id FROM point_lots WHERE username = $1`, login)
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var source, id string
+		require.NoError(t, rows.Scan(&source, &id))
+		ids[source] = id
+	}
+	require.NoError(t, rows.Err())
+	return ids
+}
+
+// dbTime returns the database clock moved by offset, in the form the TIMESTAMP
+// columns hold it. Times from time.Now would be off by the zone difference
+// between the test and the database.
+func dbTime(t *testing.T, db *DB, offset time.Duration) *time.Time {
+	t.Helper()
+	var ts time.Time
+	require.NoError(t, db.pool.QueryRow(context.Background(), `SELECT (now() + $1::interval)::timestamp`, offset).
+		Scan(&ts))
+	return &ts
+}
+
+func lotsRemaining(t *testing.T, db *DB, login string) map[string]float32 {
+	t.Helper()
+	rows, err := db.pool.Query(context.Background(),
+		`SELECT source, remaining FROM point_lots WHERE username = $1`, login)
+	require.NoError(t, err)
+	defer rows.Close()
+	remaining := make(map[string]float32)
+	for rows.Next() {
+		var source string
+		var r float32
+		require.NoError(t, rows.Scan(&source, &r))
+		remaining[source] = r
+	}
+	require.NoError(t, rows.Err())
+	return remaining
+}
+
+func TestConsumeLots(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	soon, later := dbTime(t, db, time.Hour), dbTime(t, db, 2*time.Hour)
+
+	tests := []struct {
+		wantEarliest  *time.Time
+		wantRemaining map[string]float32
+		name          string
+		amount        float32
+	}{
+		{name: "oldest first with a partial lot", amount: 40, wantEarliest: soon,
+			wantRemaining: map[string]float32{"soon": 0, "later": 40, "forever": 20}},
+		{name: "within the first lot", amount: 10, wantEarliest: soon,
+			wantRemaining: map[string]float32{"soon": 20, "later": 50, "forever": 20}},
+		{name: "lots without expiry last", amount: 90, wantEarliest: soon,
+			wantRemaining: map[string]float32{"soon": 0, "later": 0, "forever": 10}},
+		{name: "more than the lots hold", amount: 500, wantEarliest: soon,
+			wantRemaining: map[string]float32{"soon": 0, "later": 0, "forever": 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login := uniqueLogin("lots_test")
+			seedUser(t, db, login, 0)
+			cleanupUsers(t, db, login)
+			seedLots(t, db, login,
+				map[string]float32{"soon": 30, "later": 50, "forever": 20},
+				map[string]*time.Time{"soon": soon, "later": later})
+
+			var earliest *time.Time
+			err := db.withTx(ctx, "consumeLots", func(tx pgx.Tx) error {
+				if _, err := lockUserBalance(ctx, tx, login); err != nil {
+					return err
+				}
+				var err error
+				earliest, err = consumeLots(ctx, tx, login, tt.amount)
+				return err
+			})
+			require.NoError(t, err)
+
+			require.NotNil(t, earliest)
+			assert.WithinDuration(t, *tt.wantEarliest, *earliest, time.Second)
+			remaining := lotsRemaining(t, db, login)
+			for source, want := range tt.wantRemaining {
+				assert.InDelta(t, want, remaining[source], 0.001, source)
+			}
+		})
+	}
+}
+
+func TestExpireLots(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	login := uniqueLogin("expire_test")
+	seedUser(t, db, login, 0)
+	cleanupUsers(t, db, login)
+	ids := seedLots(t, db, login,
+		map[string]float32{"overdue": 25, "later": 10},
+		map[string]*time.Time{"overdue": dbTime(t, db, -time.Minute), "later": dbTime(t, db, time.Hour)})
+
+	for i := 0; i < 10; i++ {
+		n, err := db.ExpireLots(ctx)
+		require.NoError(t, err)
+		if n == 0 {
+			break
+		}
+	}
+
+	b, err := db.SelectUserBalance(ctx, login)
+	require.NoError(t, err)
+	assert.InDelta(t, 10, b.Balance, 0.001)
+	remaining := lotsRemaining(t, db, login)
+	assert.InDelta(t, 0, remaining["overdue"], 0.001)
+	assert.InDelta(t, 10, remaining["later"], 0.001)
+
+	entries, err := db.SelectBalanceHistory(ctx, login)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, history.Expiry, entries[0].Kind)
+	assert.Equal(t, ids["overdue"], entries[0].Reference)
+	assert.InDelta(t, -25, entries[0].Amount, 0.001)
+
+	_, err = db.ExpireLots(ctx)
+	require.NoError(t, err)
+	b, err = db.SelectUserBalance(ctx, login)
+	require.NoError(t, err)
+	assert.InDelta(t, 10, b.Balance, 0.001, "expired lots must not be debited twice")
+}
+
+func TestCreditedLotsExpire(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	db.SetPointsExpiry(time.Hour)
+	login := uniqueLogin("lot_ttl")
+	seedUser(t, db, login, 0)
+	cleanupUsers(t, db, login)
+
+	processOrder(t, db, login, 40)
+	soon, err := db.SelectExpiringPoints(ctx, login, 30*time.Minute)
+	require.NoError(t, err)
+	assert.Zero(t, soon)
+	within, err := db.SelectExpiringPoints(ctx, login, 2*time.Hour)
+	require.NoError(t, err)
+	assert.InDelta(t, 40, within, 0.001, "credited points expire an hour after the accrual")
+}
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE IF EXISTS password_reset_tokens CASCADE;
+
+ALTER TABLE users DROP COLUMN IF EXISTS token_version;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,15 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN token_version INTEGER DEFAULT 0 NOT NULL;
+
+CREATE TABLE password_reset_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    username VARCHAR(200) NOT NULL ,
+    token_hash VARCHAR(64) UNIQUE NOT NULL ,
+    created_at TIMESTAMP DEFAULT now() NOT NULL ,
+    expires_at TIMESTAMP NOT NULL ,
+    used_at TIMESTAMP NULL ,
+    FOREIGN KEY(username) REFERENCES users(login)
+);
+
+COMMIT;
\ No newline at end of file
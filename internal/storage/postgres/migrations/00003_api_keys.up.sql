@@ -0,0 +1,16 @@
+BEGIN;
+
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    username VARCHAR(200) NOT NULL ,
+    name VARCHAR(200) NOT NULL ,
+    prefix VARCHAR(16) UNIQUE NOT NULL ,
+    key_hash VARCHAR(64) NOT NULL ,
+    scopes TEXT[] NOT NULL ,
+    created_at TIMESTAMP DEFAULT now() NOT NULL ,
+    last_used_at TIMESTAMP NULL ,
+    revoked_at TIMESTAMP NULL ,
+    FOREIGN KEY(username) REFERENCES users(login)
+);
+
+COMMIT;
\ No newline at end of file
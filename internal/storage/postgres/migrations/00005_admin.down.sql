@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE IF EXISTS admin_audit CASCADE;
+
+ALTER TABLE users DROP COLUMN IF EXISTS blocked_at;
+
+COMMIT;
\ No newline at end of file
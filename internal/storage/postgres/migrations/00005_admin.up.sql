@@ -0,0 +1,15 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN blocked_at TIMESTAMP NULL;
+
+CREATE TABLE admin_audit (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    admin VARCHAR(200) NOT NULL ,
+    action VARCHAR(80) NOT NULL ,
+    target VARCHAR(200) NOT NULL ,
+    reason TEXT NOT NULL ,
+    created_at TIMESTAMP DEFAULT now() NOT NULL ,
+    FOREIGN KEY(admin) REFERENCES users(login)
+);
+
+COMMIT;
\ No newline at end of file
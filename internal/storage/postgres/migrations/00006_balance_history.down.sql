@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP TABLE IF EXISTS balance_adjustments CASCADE;
+
+DROP FUNCTION IF EXISTS forbid_modification();
+
+DROP TABLE IF EXISTS balance_history CASCADE;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,43 @@
+BEGIN;
+
+CREATE TABLE balance_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    username VARCHAR(200) NOT NULL ,
+    kind VARCHAR(40) NOT NULL ,
+    amount REAL NOT NULL ,
+    reference VARCHAR(200) NULL ,
+    comment TEXT NULL ,
+    created_at TIMESTAMP DEFAULT now() NOT NULL ,
+    FOREIGN KEY(username) REFERENCES users(login)
+);
+
+CREATE INDEX balance_history_username_idx ON balance_history (username, created_at);
+
+CREATE TABLE balance_adjustments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    username VARCHAR(200) NOT NULL ,
+    amount REAL NOT NULL ,
+    reason_code VARCHAR(40) NOT NULL ,
+    comment TEXT NOT NULL ,
+    admin VARCHAR(200) NOT NULL ,
+    created_at TIMESTAMP DEFAULT now() NOT NULL ,
+    FOREIGN KEY(username) REFERENCES users(login),
+    FOREIGN KEY(admin) REFERENCES users(login)
+);
+
+CREATE FUNCTION forbid_modification() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER balance_adjustments_append_only BEFORE UPDATE OR DELETE ON balance_adjustments
+    FOR EACH ROW EXECUTE FUNCTION forbid_modification();
+
+INSERT INTO balance_history (username, kind, amount, reference, created_at)
+    SELECT username, 'ACCRUAL', accrual, id, created_at FROM orders WHERE status = 'PROCESSED' AND accrual > 0;
+
+INSERT INTO balance_history (username, kind, amount, reference, created_at)
+    SELECT username, 'WITHDRAWAL', -withdrawn, order_number, processed_at FROM withdraws;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE IF EXISTS order_reversals CASCADE;
+
+ALTER TABLE users DROP COLUMN IF EXISTS points_debt;
+
+COMMIT;
\ No newline at end of file
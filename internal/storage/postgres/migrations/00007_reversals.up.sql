@@ -0,0 +1,20 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN points_debt REAL DEFAULT 0 NOT NULL;
+
+CREATE TABLE order_reversals (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id VARCHAR(80) UNIQUE NOT NULL ,
+    username VARCHAR(200) NOT NULL ,
+    accrual REAL NOT NULL ,
+    debited REAL NOT NULL ,
+    shortfall REAL NOT NULL ,
+    policy VARCHAR(20) NOT NULL ,
+    reason TEXT NOT NULL ,
+    actor VARCHAR(200) NOT NULL ,
+    created_at TIMESTAMP DEFAULT now() NOT NULL ,
+    FOREIGN KEY(order_id) REFERENCES orders(id),
+    FOREIGN KEY(username) REFERENCES users(login)
+);
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS point_lots CASCADE;
+
+COMMIT;
\ No newline at end of file
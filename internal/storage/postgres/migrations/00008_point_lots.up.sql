@@ -0,0 +1,23 @@
+BEGIN;
+
+CREATE TABLE point_lots (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    username VARCHAR(200) NOT NULL ,
+    source VARCHAR(200) NOT NULL ,
+    amount REAL NOT NULL ,
+    remaining REAL NOT NULL ,
+    created_at TIMESTAMP DEFAULT now() NOT NULL ,
+    expires_at TIMESTAMP NULL ,
+    CONSTRAINT remaining_positive_check CHECK (remaining >= 0),
+    FOREIGN KEY(username) REFERENCES users(login)
+);
+
+CREATE INDEX point_lots_username_idx ON point_lots (username, expires_at, created_at) WHERE remaining > 0;
+
+CREATE INDEX point_lots_expires_at_idx ON point_lots (expires_at) WHERE remaining > 0;
+
+-- Points accrued before lots were introduced never expire.
+INSERT INTO point_lots (username, source, amount, remaining)
+    SELECT login, 'MIGRATION', balance, balance FROM users WHERE balance > 0;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE IF EXISTS balance_holds CASCADE;
+
+ALTER TABLE users DROP COLUMN IF EXISTS held;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,21 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN held REAL DEFAULT 0 NOT NULL;
+
+CREATE TABLE balance_holds (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    username VARCHAR(200) NOT NULL ,
+    order_number VARCHAR(80) NOT NULL ,
+    amount REAL NOT NULL ,
+    status VARCHAR(20) NOT NULL ,
+    created_at TIMESTAMP DEFAULT now() NOT NULL ,
+    expires_at TIMESTAMP NOT NULL ,
+    lots_expire_at TIMESTAMP NULL ,
+    resolved_at TIMESTAMP NULL ,
+    CONSTRAINT amount_positive_check CHECK (amount > 0),
+    FOREIGN KEY(username) REFERENCES users(login)
+);
+
+CREATE INDEX balance_holds_expires_at_idx ON balance_holds (expires_at) WHERE status = 'HELD';
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,18 @@
+BEGIN;
+
+CREATE TABLE idempotency_keys (
+    username VARCHAR(200) NOT NULL ,
+    key VARCHAR(255) NOT NULL ,
+    request_hash VARCHAR(64) NOT NULL ,
+    status_code INTEGER NULL ,
+    content_type VARCHAR(200) NULL ,
+    body BYTEA NULL ,
+    created_at TIMESTAMP DEFAULT now() NOT NULL ,
+    expires_at TIMESTAMP NOT NULL ,
+    PRIMARY KEY (username, key),
+    FOREIGN KEY(username) REFERENCES users(login)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS transfers CASCADE;
+
+COMMIT;
\ No newline at end of file
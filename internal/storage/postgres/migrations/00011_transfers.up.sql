@@ -0,0 +1,17 @@
+BEGIN;
+
+CREATE TABLE transfers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    sender VARCHAR(200) NOT NULL ,
+    recipient VARCHAR(200) NOT NULL ,
+    amount REAL NOT NULL ,
+    created_at TIMESTAMP DEFAULT now() NOT NULL ,
+    CONSTRAINT amount_positive_check CHECK (amount > 0),
+    CONSTRAINT no_self_transfer_check CHECK (sender != recipient),
+    FOREIGN KEY(sender) REFERENCES users(login),
+    FOREIGN KEY(recipient) REFERENCES users(login)
+);
+
+CREATE INDEX transfers_sender_idx ON transfers (sender, created_at);
+
+COMMIT;
\ No newline at end of file
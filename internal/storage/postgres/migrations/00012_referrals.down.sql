@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE IF EXISTS referral_bonuses CASCADE;
+ALTER TABLE users DROP COLUMN IF EXISTS referred_by;
+ALTER TABLE users DROP COLUMN IF EXISTS referral_code;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,26 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN referral_code VARCHAR(16) UNIQUE
+    DEFAULT upper(substr(md5(random()::text || clock_timestamp()::text), 1, 10));
+UPDATE users SET referral_code = DEFAULT WHERE referral_code IS NULL;
+ALTER TABLE users ALTER COLUMN referral_code SET NOT NULL;
+
+ALTER TABLE users ADD COLUMN referred_by VARCHAR(200) NULL REFERENCES users(login);
+ALTER TABLE users ADD CONSTRAINT no_self_referral_check CHECK (referred_by != login);
+
+CREATE TABLE referral_bonuses (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    referrer VARCHAR(200) NOT NULL ,
+    referee VARCHAR(200) UNIQUE NOT NULL ,
+    order_id VARCHAR(80) NOT NULL ,
+    referrer_bonus REAL NOT NULL ,
+    referee_bonus REAL NOT NULL ,
+    created_at TIMESTAMP DEFAULT now() NOT NULL ,
+    FOREIGN KEY(referrer) REFERENCES users(login),
+    FOREIGN KEY(referee) REFERENCES users(login),
+    FOREIGN KEY(order_id) REFERENCES orders(id)
+);
+
+CREATE INDEX users_referred_by_idx ON users (referred_by);
+
+COMMIT;
\ No newline at end of file
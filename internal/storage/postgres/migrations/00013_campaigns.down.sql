@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP TABLE IF EXISTS order_campaigns CASCADE;
+DROP TABLE IF EXISTS campaigns CASCADE;
+ALTER TABLE orders DROP COLUMN IF EXISTS bonus;
+ALTER TABLE users DROP COLUMN IF EXISTS tier;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,34 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN tier VARCHAR(40) NULL;
+ALTER TABLE orders ADD COLUMN bonus REAL NOT NULL DEFAULT 0;
+
+CREATE TABLE campaigns (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(200) NOT NULL ,
+    starts_at TIMESTAMP NOT NULL ,
+    ends_at TIMESTAMP NOT NULL ,
+    multiplier REAL NOT NULL DEFAULT 1,
+    flat_bonus REAL NOT NULL DEFAULT 0,
+    tier VARCHAR(40) NULL ,
+    order_prefix VARCHAR(80) NULL ,
+    created_by VARCHAR(200) NOT NULL ,
+    created_at TIMESTAMP DEFAULT now() NOT NULL ,
+    CONSTRAINT window_check CHECK (ends_at > starts_at),
+    CONSTRAINT multiplier_check CHECK (multiplier >= 1),
+    CONSTRAINT flat_bonus_check CHECK (flat_bonus >= 0),
+    FOREIGN KEY(created_by) REFERENCES users(login)
+);
+
+CREATE INDEX campaigns_window_idx ON campaigns (starts_at, ends_at);
+
+CREATE TABLE order_campaigns (
+    order_id VARCHAR(80) NOT NULL ,
+    campaign_id UUID NOT NULL ,
+    bonus REAL NOT NULL ,
+    PRIMARY KEY (order_id, campaign_id),
+    FOREIGN KEY(order_id) REFERENCES orders(id),
+    FOREIGN KEY(campaign_id) REFERENCES campaigns(id)
+);
+
+COMMIT;
\ No newline at end of file
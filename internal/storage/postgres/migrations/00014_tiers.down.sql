@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP TABLE IF EXISTS tier_changes CASCADE;
+ALTER TABLE users DROP COLUMN IF EXISTS tier_checked_at;
+ALTER TABLE users ALTER COLUMN tier DROP NOT NULL;
+ALTER TABLE users ALTER COLUMN tier DROP DEFAULT;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,21 @@
+BEGIN;
+
+UPDATE users SET tier = 'BRONZE' WHERE tier IS NULL;
+ALTER TABLE users ALTER COLUMN tier SET DEFAULT 'BRONZE';
+ALTER TABLE users ALTER COLUMN tier SET NOT NULL;
+ALTER TABLE users ADD COLUMN tier_checked_at TIMESTAMP DEFAULT now() NOT NULL;
+
+CREATE TABLE tier_changes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    username VARCHAR(200) NOT NULL ,
+    from_tier VARCHAR(40) NOT NULL ,
+    to_tier VARCHAR(40) NOT NULL ,
+    lifetime REAL NOT NULL ,
+    created_at TIMESTAMP DEFAULT now() NOT NULL ,
+    FOREIGN KEY(username) REFERENCES users(login)
+);
+
+CREATE INDEX tier_changes_username_idx ON tier_changes (username, created_at);
+CREATE INDEX users_tier_checked_idx ON users (tier_checked_at) WHERE tier != 'BRONZE';
+
+COMMIT;
\ No newline at end of file
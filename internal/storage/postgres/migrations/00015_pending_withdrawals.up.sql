@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS balance_holds_expires_at_idx;
+CREATE INDEX balance_holds_expires_at_idx ON balance_holds (expires_at) WHERE status IN ('HELD', 'PENDING_APPROVAL');
+CREATE INDEX balance_holds_pending_idx ON balance_holds (created_at) WHERE status = 'PENDING_APPROVAL';
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS fraud_flags CASCADE;
+DROP TABLE IF EXISTS upload_signals CASCADE;
+
+COMMIT;
\ No newline at end of file
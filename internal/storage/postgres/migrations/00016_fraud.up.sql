@@ -0,0 +1,30 @@
+BEGIN;
+
+CREATE TABLE upload_signals (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    username VARCHAR(200) NOT NULL ,
+    kind VARCHAR(40) NOT NULL ,
+    order_id VARCHAR(80) NULL ,
+    created_at TIMESTAMP DEFAULT now() NOT NULL ,
+    FOREIGN KEY(username) REFERENCES users(login)
+);
+
+CREATE INDEX upload_signals_username_idx ON upload_signals (username, created_at);
+
+CREATE TABLE fraud_flags (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    username VARCHAR(200) NOT NULL ,
+    invalid_number_count INT NOT NULL ,
+    conflict_count INT NOT NULL ,
+    accrual_invalid_count INT NOT NULL ,
+    reasons TEXT[] NOT NULL ,
+    flagged_at TIMESTAMP DEFAULT now() NOT NULL ,
+    cleared_at TIMESTAMP NULL ,
+    cleared_by VARCHAR(200) NULL ,
+    FOREIGN KEY(username) REFERENCES users(login),
+    FOREIGN KEY(cleared_by) REFERENCES users(login)
+);
+
+CREATE UNIQUE INDEX fraud_flags_active_idx ON fraud_flags (username) WHERE cleared_at IS NULL;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TRIGGER IF EXISTS users_referral_cycle ON users;
+DROP FUNCTION IF EXISTS forbid_referral_cycle();
+
+COMMIT;
\ No newline at end of file
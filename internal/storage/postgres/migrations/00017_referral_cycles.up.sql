@@ -0,0 +1,23 @@
+BEGIN;
+
+CREATE FUNCTION forbid_referral_cycle() RETURNS trigger AS $$
+BEGIN
+    IF NEW.referred_by IS NOT NULL AND EXISTS (
+        WITH RECURSIVE chain AS (
+            SELECT login, referred_by FROM users WHERE login = NEW.referred_by
+            UNION
+            SELECT u.login, u.referred_by FROM users u JOIN chain c ON u.login = c.referred_by
+        )
+        SELECT 1 FROM chain WHERE login = NEW.login
+    ) THEN
+        RAISE EXCEPTION 'referral of % by % would create a loop', NEW.login, NEW.referred_by
+            USING ERRCODE = 'check_violation';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_referral_cycle BEFORE INSERT OR UPDATE OF referred_by ON users
+    FOR EACH ROW EXECUTE FUNCTION forbid_referral_cycle();
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,24 @@
+package postgres
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestMigration(t *testing.T) {
+	entries, err := migrationsDir.ReadDir("migrations")
+	require.NoError(t, err)
+	var ups uint
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".up.sql") {
+			ups++
+		}
+	}
+
+	version, err := latestMigration()
+	require.NoError(t, err)
+	assert.Equal(t, ups, version)
+}
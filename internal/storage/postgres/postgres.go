@@ -5,6 +5,8 @@ import (
 	"embed"
 	"errors"
 	"fmt"
+	"io/fs"
+	"sync"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
@@ -13,15 +15,32 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/fraud"
+	"github.com/ospiem/gophermart/internal/models/history"
+	"github.com/ospiem/gophermart/internal/models/limit"
+	"github.com/ospiem/gophermart/internal/models/role"
 	"github.com/ospiem/gophermart/internal/models/status"
+	"github.com/ospiem/gophermart/internal/models/tier"
+	"github.com/ospiem/gophermart/internal/tracing"
 	"github.com/rs/zerolog"
 )
 
+var ErrDirtyMigration = errors.New("a migration has failed halfway")
+var ErrOutdatedSchema = errors.New("the schema is older than the binary")
+
 const retryAttempts = 3
 const defaultSleepInterval = 500
 
 type DB struct {
-	pool *pgxpool.Pool
+	pool          *pgxpool.Pool
+	pointsTTL     time.Duration
+	tiers         tier.Rules
+	referrerBonus float32
+	refereeBonus  float32
+	// settingsMu guards the settings that can be reloaded at runtime.
+	settingsMu sync.RWMutex
+	limits     limit.Limits
+	fraud      fraud.Thresholds
 }
 
 //go:embed migrations/*.sql
@@ -48,6 +67,8 @@ func initPool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
+	pgConfig.ConnConfig.Tracer = tracing.QueryTracer{}
+
 	pool, err := pgxpool.NewWithConfig(ctx, pgConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create pool: %w", err)
@@ -60,6 +81,30 @@ func initPool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
 	return pool, nil
 }
 
+// latestMigration returns the version of the newest embedded migration.
+func latestMigration() (uint, error) {
+	d, err := iofs.New(migrationsDir, "migrations")
+	if err != nil {
+		return 0, fmt.Errorf("failed to return an iofs driver: %w", err)
+	}
+	defer func() { _ = d.Close() }()
+
+	version, err := d.First()
+	if err != nil {
+		return 0, fmt.Errorf("cannot read the first migration: %w", err)
+	}
+	for {
+		next, err := d.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("cannot read the migration after %d: %w", version, err)
+		}
+		version = next
+	}
+}
+
 func runMigrations(dsn string) error {
 	d, err := iofs.New(migrationsDir, "migrations")
 	if err != nil {
@@ -80,8 +125,8 @@ func runMigrations(dsn string) error {
 	return nil
 }
 
-func (db *DB) InsertOrder(ctx context.Context, order models.Order, l zerolog.Logger) error {
-	logger := l.With().Str("DB method", "InsertOrder").Logger()
+func (db *DB) InsertOrder(ctx context.Context, order models.Order) error {
+	logger := zerolog.Ctx(ctx).With().Str("DB method", "InsertOrder").Logger()
 
 	tx, err := db.pool.Begin(ctx)
 	if err != nil {
@@ -109,6 +154,42 @@ func (db *DB) Close() {
 	db.pool.Close()
 }
 
+// Ping checks that a connection can be acquired and used.
+func (db *DB) Ping(ctx context.Context) error {
+	if err := db.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("cannot ping DB: %w", err)
+	}
+	return nil
+}
+
+// CheckMigrations fails if the schema is dirty or older than the migrations
+// embedded in the binary.
+func (db *DB) CheckMigrations(ctx context.Context) error {
+	want, err := latestMigration()
+	if err != nil {
+		return err
+	}
+	var (
+		version uint
+		dirty   bool
+	)
+	if err := db.pool.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations`).Scan(&version, &dirty); err != nil {
+		return fmt.Errorf("cannot select migration version: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("%w: version %d", ErrDirtyMigration, version)
+	}
+	if version < want {
+		return fmt.Errorf("%w: version %d, want %d", ErrOutdatedSchema, version, want)
+	}
+	return nil
+}
+
+// Stat returns the statistics of the connection pool.
+func (db *DB) Stat() *pgxpool.Stat {
+	return db.pool.Stat()
+}
+
 func (db *DB) SelectOrder(ctx context.Context, num string) (models.Order, error) {
 	order := models.Order{}
 	row := db.pool.QueryRow(ctx,
@@ -122,8 +203,9 @@ func (db *DB) SelectOrder(ctx context.Context, num string) (models.Order, error)
 
 func (db *DB) SelectOrders(ctx context.Context, login string) ([]models.OrderResponse, error) {
 	rows, err := db.pool.Query(ctx,
-		`SELECT id, status, created_at, COALESCE(accrual, 0) AS accrual
-			 FROM orders WHERE username = $1 ORDER BY created_at DESC`, login)
+		`SELECT id, status, created_at, CASE WHEN status = $2 THEN 0 ELSE COALESCE(accrual, 0) END AS accrual,
+				CASE WHEN status = $2 THEN 0 ELSE bonus END AS bonus
+			 FROM orders WHERE username = $1 ORDER BY created_at DESC`, login, status.REVERSED)
 	if err != nil {
 		return nil, fmt.Errorf("postgres failed to get orders: %w", err)
 	}
@@ -132,7 +214,7 @@ func (db *DB) SelectOrders(ctx context.Context, login string) ([]models.OrderRes
 	orders := make([]models.OrderResponse, 0, rows.CommandTag().RowsAffected())
 	for rows.Next() {
 		order := models.OrderResponse{}
-		if err := rows.Scan(&order.Number, &order.Status, &order.UploatedAt, &order.Accrual); err != nil {
+		if err := rows.Scan(&order.Number, &order.Status, &order.UploatedAt, &order.Accrual, &order.Bonus); err != nil {
 			return nil, fmt.Errorf("cannot select the order: %w", err)
 		}
 		orders = append(orders, order)
@@ -143,9 +225,9 @@ func (db *DB) SelectOrders(ctx context.Context, login string) ([]models.OrderRes
 func (db *DB) SelectUserBalance(ctx context.Context, login string) (models.UserBalance, error) {
 	ub := models.UserBalance{}
 	row := db.pool.QueryRow(ctx,
-		`SELECT COALESCE(balance, 0) as balance, COALESCE(total_withdrawn, 0) as total_withdrawn
-			from users where login = $1`, login)
-	if err := row.Scan(&ub.Balance, &ub.Withdrawn); err != nil {
+		`SELECT COALESCE(balance, 0) as balance, COALESCE(total_withdrawn, 0) as total_withdrawn, held, points_debt,
+				tier from users where login = $1`, login)
+	if err := row.Scan(&ub.Balance, &ub.Withdrawn, &ub.Held, &ub.Debt, &ub.Tier); err != nil {
 		return models.UserBalance{}, fmt.Errorf("cannot select user balance: %w", err)
 	}
 	return ub, nil
@@ -154,16 +236,18 @@ func (db *DB) SelectUserBalance(ctx context.Context, login string) (models.UserB
 func (db *DB) SelectCreds(ctx context.Context, login string) (models.Credentials, error) {
 	c := models.Credentials{}
 	row := db.pool.QueryRow(ctx,
-		`SELECT login, hash_password
+		`SELECT login, hash_password, token_version, role, blocked_at IS NOT NULL
 			from users where login = $1`, login)
-	if err := row.Scan(&c.Login, &c.Pass); err != nil {
+	if err := row.Scan(&c.Login, &c.Pass, &c.TokenVersion, &c.Role, &c.Blocked); err != nil {
 		return models.Credentials{}, fmt.Errorf("cannot select user balance: %w", err)
 	}
 	return c, nil
 }
 
-func (db *DB) InsertUser(ctx context.Context, login string, hash string, l zerolog.Logger) error {
-	logger := l.With().Str("func", "InsertUser").Logger()
+// InsertUser creates a user. A non-empty referral is the referral code of the
+// user who invited them.
+func (db *DB) InsertUser(ctx context.Context, login string, hash string, referral string) error {
+	logger := zerolog.Ctx(ctx).With().Str("func", "InsertUser").Logger()
 
 	tx, err := db.pool.Begin(ctx)
 	if err != nil {
@@ -174,10 +258,18 @@ func (db *DB) InsertUser(ctx context.Context, login string, hash string, l zerol
 			logger.Debug().Err(err).Msg("cannot rollback tx in InsertUser")
 		}
 	}()
+	var referrer *string
+	if referral != "" {
+		r, err := selectReferrer(ctx, tx, login, referral)
+		if err != nil {
+			return err
+		}
+		referrer = &r
+	}
 	err = updateWithRetry(ctx, tx,
-		`INSERT INTO users (login, hash_password) VALUES ($1, $2)
+		`INSERT INTO users (login, hash_password, referred_by) VALUES ($1, $2, $3)
 				ON CONFLICT DO NOTHING`,
-		login, hash,
+		login, hash, referrer,
 	)
 	if err != nil {
 		return fmt.Errorf("cannot insert user: %w", err)
@@ -188,8 +280,43 @@ func (db *DB) InsertUser(ctx context.Context, login string, hash string, l zerol
 	return nil
 }
 
-func (db *DB) InsertWithdraw(ctx context.Context, w models.Withdraw, l zerolog.Logger) error {
-	logger := l.With().Str("func", "InsertWithdraw").Logger()
+func (db *DB) SelectTokenVersion(ctx context.Context, login string) (int, error) {
+	var version int
+	row := db.pool.QueryRow(ctx, `SELECT token_version FROM users WHERE login = $1`, login)
+	if err := row.Scan(&version); err != nil {
+		return 0, fmt.Errorf("cannot select token version: %w", err)
+	}
+	return version, nil
+}
+
+// UpdatePassword sets a new password hash and bumps the user's token version,
+// which invalidates every token issued before the change.
+func (db *DB) UpdatePassword(ctx context.Context, login string, hash string) (models.Credentials, error) {
+	logger := zerolog.Ctx(ctx).With().Str("func", "UpdatePassword").Logger()
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return models.Credentials{}, fmt.Errorf("cannot start a transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			logger.Debug().Err(err).Msg("cannot rollback tx")
+		}
+	}()
+
+	c, err := updatePassword(ctx, tx, login, hash)
+	if err != nil {
+		return models.Credentials{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return models.Credentials{}, fmt.Errorf("cannot commit transaction in UpdatePassword: %w", err)
+	}
+	return c, nil
+}
+
+// InsertResetToken stores a reset token that expires after ttl. The expiry is
+// computed by the database, the clock every token check compares with.
+func (db *DB) InsertResetToken(ctx context.Context, login string, tokenHash string, ttl time.Duration) error {
+	logger := zerolog.Ctx(ctx).With().Str("func", "InsertResetToken").Logger()
 	tx, err := db.pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("cannot start a transaction: %w", err)
@@ -200,6 +327,226 @@ func (db *DB) InsertWithdraw(ctx context.Context, w models.Withdraw, l zerolog.L
 		}
 	}()
 
+	err = updateWithRetry(ctx, tx,
+		`INSERT INTO password_reset_tokens (username, token_hash, expires_at) VALUES ($1, $2, now() + $3::interval)`,
+		login, tokenHash, ttl,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot insert reset token: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("cannot commit transaction in InsertResetToken: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword consumes an unused, unexpired reset token and sets a new password
+// for its owner. It returns pgx.ErrNoRows when the token cannot be used and
+// models.ErrUserBlocked, changing nothing, when the owner is blocked.
+func (db *DB) ResetPassword(ctx context.Context, tokenHash string, hash string) (models.Credentials, error) {
+	logger := zerolog.Ctx(ctx).With().Str("func", "ResetPassword").Logger()
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return models.Credentials{}, fmt.Errorf("cannot start a transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			logger.Debug().Err(err).Msg("cannot rollback tx")
+		}
+	}()
+
+	var login string
+	var blocked bool
+	row := tx.QueryRow(ctx,
+		`SELECT t.username, u.blocked_at IS NOT NULL FROM password_reset_tokens t JOIN users u ON u.login = t.username
+			WHERE t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > now() FOR UPDATE OF t`, tokenHash)
+	if err := row.Scan(&login, &blocked); err != nil {
+		return models.Credentials{}, fmt.Errorf("cannot select reset token: %w", err)
+	}
+	// A blocked user keeps both the token and the old password.
+	if blocked {
+		return models.Credentials{}, models.ErrUserBlocked
+	}
+	_, err = tx.Exec(ctx, `UPDATE password_reset_tokens SET used_at = now() WHERE token_hash = $1`, tokenHash)
+	if err != nil {
+		return models.Credentials{}, fmt.Errorf("cannot use reset token: %w", err)
+	}
+
+	c, err := updatePassword(ctx, tx, login, hash)
+	if err != nil {
+		return models.Credentials{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return models.Credentials{}, fmt.Errorf("cannot commit transaction in ResetPassword: %w", err)
+	}
+	return c, nil
+}
+
+func updatePassword(ctx context.Context, tx pgx.Tx, login string, hash string) (models.Credentials, error) {
+	c := models.Credentials{}
+	row := tx.QueryRow(ctx,
+		`UPDATE users SET hash_password = $1, token_version = token_version + 1 WHERE login = $2
+			RETURNING login, token_version, role, blocked_at IS NOT NULL`, hash, login)
+	if err := row.Scan(&c.Login, &c.TokenVersion, &c.Role, &c.Blocked); err != nil {
+		return models.Credentials{}, fmt.Errorf("cannot update password: %w", err)
+	}
+
+	// Reset tokens issued before the change must not be usable afterwards.
+	_, err := tx.Exec(ctx,
+		`UPDATE password_reset_tokens SET used_at = now() WHERE username = $1 AND used_at IS NULL`, login)
+	if err != nil {
+		return models.Credentials{}, fmt.Errorf("cannot revoke reset tokens: %w", err)
+	}
+	return c, nil
+}
+
+// PromoteFirstAdmin gives the user the admin role if nobody has it yet and
+// reports whether it did. An admin who has been demoted stays demoted. It
+// returns pgx.ErrNoRows when the user does not exist.
+func (db *DB) PromoteFirstAdmin(ctx context.Context, login string) (bool, error) {
+	logger := zerolog.Ctx(ctx).With().Str("func", "PromoteFirstAdmin").Logger()
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("cannot start a transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			logger.Debug().Err(err).Msg("cannot rollback tx")
+		}
+	}()
+
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT true FROM users WHERE login = $1`, login).Scan(&exists); err != nil {
+		return false, fmt.Errorf("cannot select user: %w", err)
+	}
+	tag, err := tx.Exec(ctx,
+		`UPDATE users SET role = $1, token_version = token_version + 1
+			WHERE login = $2 AND NOT EXISTS (SELECT 1 FROM users WHERE role = $1)`, role.Admin, login)
+	if err != nil {
+		return false, fmt.Errorf("cannot update role: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("cannot commit transaction in PromoteFirstAdmin: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (db *DB) InsertAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	logger := zerolog.Ctx(ctx).With().Str("func", "InsertAPIKey").Logger()
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("cannot start a transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			logger.Debug().Err(err).Msg("cannot rollback tx")
+		}
+	}()
+
+	row := tx.QueryRow(ctx,
+		`INSERT INTO api_keys (username, name, prefix, key_hash, scopes) VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at`,
+		key.Username, key.Name, key.Prefix, key.Hash, key.Scopes)
+	if err := row.Scan(&key.ID, &key.CreatedAt); err != nil {
+		return models.APIKey{}, fmt.Errorf("cannot insert api key: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return models.APIKey{}, fmt.Errorf("cannot commit transaction in InsertAPIKey: %w", err)
+	}
+	return key, nil
+}
+
+func (db *DB) SelectAPIKeys(ctx context.Context, login string) ([]models.APIKey, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT id, name, prefix, scopes, created_at, last_used_at, revoked_at
+			FROM api_keys WHERE username = $1 ORDER BY created_at DESC`, login)
+	if err != nil {
+		return nil, fmt.Errorf("postgres failed to get api keys: %w", err)
+	}
+
+	keys := make([]models.APIKey, 0, rows.CommandTag().RowsAffected())
+	for rows.Next() {
+		k := models.APIKey{Username: login}
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &k.Scopes, &k.CreatedAt, &k.LastUsedAt,
+			&k.RevokedAt); err != nil {
+			return nil, fmt.Errorf("cannot scan api key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// SelectAPIKeyByPrefix returns an active api key with its hash.
+func (db *DB) SelectAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error) {
+	k := models.APIKey{}
+	row := db.pool.QueryRow(ctx,
+		`SELECT k.id, k.username, k.name, k.prefix, k.key_hash, k.scopes, k.created_at
+			FROM api_keys k JOIN users u ON u.login = k.username
+			WHERE k.prefix = $1 AND k.revoked_at IS NULL AND u.blocked_at IS NULL`, prefix)
+	if err := row.Scan(&k.ID, &k.Username, &k.Name, &k.Prefix, &k.Hash, &k.Scopes, &k.CreatedAt); err != nil {
+		return models.APIKey{}, fmt.Errorf("cannot select api key: %w", err)
+	}
+	return k, nil
+}
+
+func (db *DB) TouchAPIKey(ctx context.Context, id string) error {
+	if _, err := db.pool.Exec(ctx, `UPDATE api_keys SET last_used_at = now() WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("cannot update api key last usage: %w", err)
+	}
+	return nil
+}
+
+// RevokeAPIKey returns pgx.ErrNoRows when the user has no active key with the given id.
+func (db *DB) RevokeAPIKey(ctx context.Context, login string, id string) error {
+	logger := zerolog.Ctx(ctx).With().Str("func", "RevokeAPIKey").Logger()
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot start a transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			logger.Debug().Err(err).Msg("cannot rollback tx")
+		}
+	}()
+
+	if err := revokeAPIKey(ctx, tx, login, id); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("cannot commit transaction in RevokeAPIKey: %w", err)
+	}
+	return nil
+}
+
+func revokeAPIKey(ctx context.Context, tx pgx.Tx, login string, id string) error {
+	tag, err := tx.Exec(ctx,
+		`UPDATE api_keys SET revoked_at = now() WHERE id::text = $1 AND username = $2 AND revoked_at IS NULL`,
+		id, login)
+	if err != nil {
+		return fmt.Errorf("cannot revoke api key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("cannot revoke api key: %w", pgx.ErrNoRows)
+	}
+	return nil
+}
+
+func (db *DB) InsertWithdraw(ctx context.Context, w models.Withdraw) error {
+	logger := zerolog.Ctx(ctx).With().Str("func", "InsertWithdraw").Logger()
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot start a transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			logger.Debug().Err(err).Msg("cannot rollback tx")
+		}
+	}()
+
+	if err := db.checkWithdrawLimit(ctx, tx, w.User, w.Sum); err != nil {
+		return err
+	}
+
 	var wID string
 	row := tx.QueryRow(ctx,
 		`INSERT INTO withdraws (username, withdrawn, order_number) VALUES ($1, $2, $3)
@@ -218,6 +565,9 @@ func (db *DB) InsertWithdraw(ctx context.Context, w models.Withdraw, l zerolog.L
 	if err != nil {
 		return fmt.Errorf("cannot update user's balance: %w", err)
 	}
+	if _, err := consumeLots(ctx, tx, w.User, w.Sum); err != nil {
+		return err
+	}
 
 	err = updateWithRetry(ctx, tx,
 		`UPDATE orders SET  withdraw = $1 WHERE id = $2;`,
@@ -226,6 +576,16 @@ func (db *DB) InsertWithdraw(ctx context.Context, w models.Withdraw, l zerolog.L
 	if err != nil {
 		return fmt.Errorf("cannot update user's order: %w", err)
 	}
+
+	err = insertHistory(ctx, tx, models.HistoryEntry{
+		Username:  w.User,
+		Kind:      history.Withdrawal,
+		Amount:    -w.Sum,
+		Reference: w.OrderNumber,
+	})
+	if err != nil {
+		return err
+	}
 	if err := tx.Commit(ctx); err != nil {
 		return fmt.Errorf("cannot commit transaction in InsertWithdraw: %w", err)
 	}
@@ -254,8 +614,8 @@ func (db *DB) SelectWithdraws(ctx context.Context, login string) ([]models.Withd
 
 func (db *DB) SelectOrdersToProceed(ctx context.Context, pagination int, offset *int) ([]models.Order, error) {
 	var totalRows int
-	err := db.pool.QueryRow(ctx, `SELECT count(*) FROM orders WHERE status NOT IN ($1, $2)`,
-		status.PROCESSED, status.INVALID).Scan(&totalRows)
+	err := db.pool.QueryRow(ctx, `SELECT count(*) FROM orders WHERE status NOT IN ($1, $2, $3)`,
+		status.PROCESSED, status.INVALID, status.REVERSED).Scan(&totalRows)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get total amount of rows: %w", err)
 	}
@@ -265,8 +625,8 @@ func (db *DB) SelectOrdersToProceed(ctx context.Context, pagination int, offset
 
 	rows, err := db.pool.Query(ctx,
 		`SELECT id, status, created_at, COALESCE(accrual, 0) as accrual, username FROM orders 
-            WHERE status NOT IN ($1, $2) ORDER BY created_at LIMIT $3 OFFSET $4`,
-		status.PROCESSED, status.INVALID, pagination, *offset,
+            WHERE status NOT IN ($1, $2, $3) ORDER BY created_at LIMIT $4 OFFSET $5`,
+		status.PROCESSED, status.INVALID, status.REVERSED, pagination, *offset,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get orders from db: %w", err)
@@ -284,8 +644,39 @@ func (db *DB) SelectOrdersToProceed(ctx context.Context, pagination int, offset
 	return orders, nil
 }
 
-func (db *DB) ProcessOrderWithBonuses(ctx context.Context, order models.Order, l *zerolog.Logger) error {
-	logger := l.With().Str("func", "ProcessOrderWithBonuses").Logger()
+// CountPendingOrders returns the number of orders still waiting for the accrual
+// system, by status.
+func (db *DB) CountPendingOrders(ctx context.Context) (map[string]int, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT status, count(*) FROM orders WHERE status NOT IN ($1, $2, $3) GROUP BY status`,
+		status.PROCESSED, status.INVALID, status.REVERSED)
+	if err != nil {
+		return nil, fmt.Errorf("cannot count pending orders: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var (
+			s string
+			n int
+		)
+		if err := rows.Scan(&s, &n); err != nil {
+			return nil, fmt.Errorf("cannot scan pending orders count: %w", err)
+		}
+		counts[s] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot count pending orders: %w", err)
+	}
+	return counts, nil
+}
+
+func (db *DB) ProcessOrderWithBonuses(ctx context.Context, order models.Order) (err error) {
+	ctx, span := tracing.Start(ctx, "postgres.ProcessOrderWithBonuses")
+	defer func() { tracing.End(span, err) }()
+
+	logger := zerolog.Ctx(ctx).With().Str("func", "ProcessOrderWithBonuses").Logger()
 	tx, err := db.pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("cannot start a transaction: %w", err)
@@ -301,24 +692,32 @@ func (db *DB) ProcessOrderWithBonuses(ctx context.Context, order models.Order, l
 		if err != nil {
 			return fmt.Errorf("cannot update status: %w", err)
 		}
+		if order.Status == status.INVALID {
+			if err := db.recordAccrualInvalid(ctx, tx, order.ID); err != nil {
+				return err
+			}
+		}
 		if err = tx.Commit(ctx); err != nil {
 			return fmt.Errorf("cannot commit transaction in ProcessOrderWithBonuses: %w", err)
 		}
 		return nil
 	}
 
+	// A stale copy of a processed or reversed order must not credit it again.
 	row := tx.QueryRow(ctx,
-		`UPDATE orders SET status = $1, accrual = $2 where id = $3 and status != $4
+		`UPDATE orders SET status = $1, accrual = $2 where id = $3 and status NOT IN ($4, $5)
  			RETURNING username;`,
-		order.Status, order.Accrual, order.ID, status.PROCESSED)
+		order.Status, order.Accrual, order.ID, status.PROCESSED, status.REVERSED)
 	if err := row.Scan(&order.Username); err != nil {
 		return fmt.Errorf("cannot update status and accrual: %w", err)
 	}
 
-	err = updateWithRetry(ctx, tx, `UPDATE users SET balance = COALESCE(balance, 0) + $1 where login = $2`,
-		order.Accrual, order.Username)
-	if err != nil {
-		return fmt.Errorf("cannot update user's balance: %w", err)
+	// The referral bonus goes first: it locks both users in login order.
+	if err := db.creditReferralBonus(ctx, tx, order); err != nil {
+		return err
+	}
+	if err := db.creditAccrual(ctx, tx, order); err != nil {
+		return err
 	}
 	if err = tx.Commit(ctx); err != nil {
 		return fmt.Errorf("cannot commit transaction in ProcessOrderWithBonuses: %w", err)
@@ -326,6 +725,82 @@ func (db *DB) ProcessOrderWithBonuses(ctx context.Context, order models.Order, l
 	return nil
 }
 
+// creditAccrual credits the order's accrual to its owner, followed by the
+// bonus of the owner's tier and of any running campaigns that target the order.
+// The owner's tier is recalculated afterwards.
+func (db *DB) creditAccrual(ctx context.Context, tx pgx.Tx, order models.Order) error {
+	if err := db.creditPoints(ctx, tx, order.Username, order.Accrual, history.Accrual, order.ID); err != nil {
+		return err
+	}
+	tierBonus, err := db.creditTierBonus(ctx, tx, order)
+	if err != nil {
+		return err
+	}
+	campaignBonus, err := applyCampaigns(ctx, tx, order)
+	if err != nil {
+		return err
+	}
+	if campaignBonus > 0 {
+		err := db.creditPoints(ctx, tx, order.Username, campaignBonus, history.CampaignBonus, order.ID)
+		if err != nil {
+			return err
+		}
+	}
+	if bonus := tierBonus + campaignBonus; bonus > 0 {
+		err := updateWithRetry(ctx, tx, `UPDATE orders SET bonus = $1 WHERE id = $2`, bonus, order.ID)
+		if err != nil {
+			return fmt.Errorf("cannot update order bonus: %w", err)
+		}
+	}
+	return db.recalculateTier(ctx, tx, order.Username)
+}
+
+// creditPoints credits amount to the user as a new lot and records it in the
+// balance history under kind. A reversal debt, if any, is repaid first.
+func (db *DB) creditPoints(ctx context.Context, tx pgx.Tx, login string, amount float32,
+	kind history.Kind, reference string) error {
+	var debt float32
+	row := tx.QueryRow(ctx, `SELECT points_debt FROM users WHERE login = $1 FOR UPDATE`, login)
+	if err := row.Scan(&debt); err != nil {
+		return fmt.Errorf("cannot lock user: %w", err)
+	}
+	repaid := min(debt, amount)
+
+	err := updateWithRetry(ctx, tx,
+		`UPDATE users SET balance = COALESCE(balance, 0) + $1, points_debt = points_debt - $2 where login = $3`,
+		amount-repaid, repaid, login)
+	if err != nil {
+		return fmt.Errorf("cannot update user's balance: %w", err)
+	}
+	if err := db.addLot(ctx, tx, login, amount-repaid, reference); err != nil {
+		return err
+	}
+
+	if amount > 0 {
+		err = insertHistory(ctx, tx, models.HistoryEntry{
+			Username:  login,
+			Kind:      kind,
+			Amount:    amount,
+			Reference: reference,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if repaid > 0 {
+		err = insertHistory(ctx, tx, models.HistoryEntry{
+			Username:  login,
+			Kind:      history.DebtRepayment,
+			Amount:    -repaid,
+			Reference: reference,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func updateWithRetry(ctx context.Context, tx pgx.Tx, query string, args ...interface{}) error {
 	for attempt := 0; attempt < retryAttempts; attempt++ {
 		tag, err := tx.Exec(ctx, query, args...)
@@ -348,3 +823,28 @@ func updateWithRetry(ctx context.Context, tx pgx.Tx, query string, args ...inter
 
 	return fmt.Errorf("reached maximum retry attempts")
 }
+
+// withTx runs fn in a transaction and commits it if fn succeeds.
+func (db *DB) withTx(ctx context.Context, method string, fn func(tx pgx.Tx) error) (err error) {
+	ctx, span := tracing.Start(ctx, "postgres."+method)
+	defer func() { tracing.End(span, err) }()
+
+	logger := zerolog.Ctx(ctx).With().Str("func", method).Logger()
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot start a transaction in %s: %w", method, err)
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil {
+			logger.Debug().Err(err).Msg("cannot rollback tx")
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("cannot commit transaction in %s: %w", method, err)
+	}
+	return nil
+}
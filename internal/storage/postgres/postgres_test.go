@@ -0,0 +1,160 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/role"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// uniqueLogin returns a login no earlier run has used. Some rows, such as
+// balance adjustments, cannot be deleted, so their users cannot be reused.
+func uniqueLogin(prefix string) string {
+	return fmt.Sprintf("%s_%d", prefix, time.Now().UnixNano())
+}
+
+// cleanupUsers deletes the users and everything that refers to them once the
+// test is done. Users with append-only rows are left behind.
+func cleanupUsers(t *testing.T, db *DB, logins ...string) {
+	t.Helper()
+	t.Cleanup(func() {
+		ctx := context.Background()
+		for _, q := range []string{
+			`DELETE FROM order_campaigns WHERE order_id IN (SELECT id FROM orders WHERE username = ANY($1))`,
+			`DELETE FROM referral_bonuses WHERE referrer = ANY($1) OR referee = ANY($1)`,
+			`DELETE FROM order_reversals WHERE username = ANY($1)`,
+			`UPDATE orders SET withdraw = NULL WHERE username = ANY($1)`,
+			`DELETE FROM withdraws WHERE username = ANY($1)`,
+			`DELETE FROM orders WHERE username = ANY($1)`,
+			`DELETE FROM balance_holds WHERE username = ANY($1)`,
+			`DELETE FROM point_lots WHERE username = ANY($1)`,
+			`DELETE FROM balance_history WHERE username = ANY($1)`,
+			`DELETE FROM transfers WHERE sender = ANY($1) OR recipient = ANY($1)`,
+			`DELETE FROM idempotency_keys WHERE username = ANY($1)`,
+			`DELETE FROM password_reset_tokens WHERE username = ANY($1)`,
+			`DELETE FROM api_keys WHERE username = ANY($1)`,
+			`DELETE FROM tier_changes WHERE username = ANY($1)`,
+			`DELETE FROM upload_signals WHERE username = ANY($1)`,
+			`DELETE FROM fraud_flags WHERE username = ANY($1) OR cleared_by = ANY($1)`,
+			`DELETE FROM campaigns WHERE created_by = ANY($1)`,
+			`DELETE FROM admin_audit WHERE admin = ANY($1)`,
+			`UPDATE users SET referred_by = NULL WHERE referred_by = ANY($1) OR login = ANY($1)`,
+			`DELETE FROM users WHERE login = ANY($1)`,
+		} {
+			_, _ = db.pool.Exec(ctx, q, logins)
+		}
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	login := uniqueLogin("reset_test")
+	seedUser(t, db, login, 0)
+	cleanupUsers(t, db, login)
+
+	fresh, expired := login+"_fresh", login+"_expired"
+	require.NoError(t, db.InsertResetToken(ctx, login, fresh, time.Hour))
+	require.NoError(t, db.InsertResetToken(ctx, login, expired, -time.Hour))
+	before, err := db.SelectTokenVersion(ctx, login)
+	require.NoError(t, err)
+
+	c, err := db.ResetPassword(ctx, fresh, "new hash")
+	require.NoError(t, err)
+	assert.Equal(t, login, c.Login)
+	assert.Equal(t, before+1, c.TokenVersion, "tokens issued before the reset must stop working")
+	creds, err := db.SelectCreds(ctx, login)
+	require.NoError(t, err)
+	assert.Equal(t, "new hash", creds.Pass)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "reused", token: fresh},
+		{name: "expired", token: expired},
+		{name: "unknown", token: login + "_unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.ResetPassword(ctx, tt.token, "other hash")
+			assert.True(t, errors.Is(err, pgx.ErrNoRows), "got %v", err)
+		})
+	}
+}
+
+func TestUpdatePasswordRevokesResetTokens(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	login := uniqueLogin("change_test")
+	seedUser(t, db, login, 0)
+	cleanupUsers(t, db, login)
+
+	token := login + "_token"
+	require.NoError(t, db.InsertResetToken(ctx, login, token, time.Hour))
+	before, err := db.SelectTokenVersion(ctx, login)
+	require.NoError(t, err)
+
+	c, err := db.UpdatePassword(ctx, login, "changed hash")
+	require.NoError(t, err)
+	assert.Equal(t, before+1, c.TokenVersion)
+
+	_, err = db.ResetPassword(ctx, token, "reset hash")
+	assert.True(t, errors.Is(err, pgx.ErrNoRows), "a token issued before the change must be unusable, got %v", err)
+	creds, err := db.SelectCreds(ctx, login)
+	require.NoError(t, err)
+	assert.Equal(t, "changed hash", creds.Pass)
+}
+
+func TestResetPasswordOfBlockedUser(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	login := uniqueLogin("blocked_reset")
+	seedUser(t, db, login, 0)
+	cleanupUsers(t, db, login)
+
+	token := login + "_token"
+	require.NoError(t, db.InsertResetToken(ctx, login, token, time.Hour))
+	_, err := db.pool.Exec(ctx, `UPDATE users SET blocked_at = now() WHERE login = $1`, login)
+	require.NoError(t, err)
+
+	_, err = db.ResetPassword(ctx, token, "new hash")
+	assert.True(t, errors.Is(err, models.ErrUserBlocked), "got %v", err)
+	creds, err := db.SelectCreds(ctx, login)
+	require.NoError(t, err)
+	assert.Equal(t, "hash", creds.Pass, "the password of a blocked user must not change")
+
+	_, err = db.pool.Exec(ctx, `UPDATE users SET blocked_at = NULL WHERE login = $1`, login)
+	require.NoError(t, err)
+	_, err = db.ResetPassword(ctx, token, "new hash")
+	assert.NoError(t, err, "the token stays usable once the user is unblocked")
+}
+
+func TestPromoteFirstAdmin(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	admin, demoted := uniqueLogin("first_admin"), uniqueLogin("demoted_admin")
+	seedUser(t, db, admin, 0)
+	seedUser(t, db, demoted, 0)
+	cleanupUsers(t, db, admin, demoted)
+
+	_, err := db.pool.Exec(ctx, `UPDATE users SET role = $1 WHERE login = $2`, role.Admin, admin)
+	require.NoError(t, err)
+
+	promoted, err := db.PromoteFirstAdmin(ctx, demoted)
+	require.NoError(t, err)
+	assert.False(t, promoted, "nobody is promoted while an admin exists")
+	creds, err := db.SelectCreds(ctx, demoted)
+	require.NoError(t, err)
+	assert.Equal(t, role.User, creds.Role)
+
+	_, err = db.PromoteFirstAdmin(ctx, uniqueLogin("missing_admin"))
+	assert.True(t, errors.Is(err, pgx.ErrNoRows), "got %v", err)
+}
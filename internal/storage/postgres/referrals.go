@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/history"
+)
+
+// SetReferralBonuses sets the points credited to the referrer and the referee
+// once the referee's first order is processed.
+func (db *DB) SetReferralBonuses(referrer, referee float32) {
+	db.referrerBonus = referrer
+	db.refereeBonus = referee
+}
+
+// selectReferrer resolves a referral code for the new user login. It refuses
+// codes of blocked users, the user's own code and codes whose referral chain
+// already leads back to login. The users_referral_cycle trigger enforces the
+// latter for every other change of referred_by.
+func selectReferrer(ctx context.Context, tx pgx.Tx, login string, code string) (string, error) {
+	var referrer string
+	row := tx.QueryRow(ctx,
+		`SELECT login FROM users WHERE referral_code = upper($1) AND blocked_at IS NULL`, code)
+	if err := row.Scan(&referrer); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", models.ErrUnknownReferral
+		}
+		return "", fmt.Errorf("cannot select referrer: %w", err)
+	}
+	if referrer == login {
+		return "", models.ErrReferralLoop
+	}
+
+	var loop bool
+	row = tx.QueryRow(ctx,
+		`WITH RECURSIVE chain AS (
+			SELECT login, referred_by FROM users WHERE login = $1
+			UNION
+			SELECT u.login, u.referred_by FROM users u JOIN chain c ON u.login = c.referred_by
+		)
+		SELECT EXISTS (SELECT 1 FROM chain WHERE login = $2)`,
+		referrer, login)
+	if err := row.Scan(&loop); err != nil {
+		return "", fmt.Errorf("cannot check referral chain: %w", err)
+	}
+	if loop {
+		return "", models.ErrReferralLoop
+	}
+	return referrer, nil
+}
+
+// creditReferralBonus pays the referral bonuses if order is the first
+// processed order of a referred user that earned an accrual. Both users are
+// locked in login order.
+func (db *DB) creditReferralBonus(ctx context.Context, tx pgx.Tx, order models.Order) error {
+	if db.referrerBonus <= 0 && db.refereeBonus <= 0 {
+		return nil
+	}
+	if order.Accrual <= 0 {
+		return nil
+	}
+	var referrer *string
+	row := tx.QueryRow(ctx,
+		`SELECT u.referred_by FROM users u
+			WHERE u.login = $1 AND NOT EXISTS (SELECT 1 FROM referral_bonuses b WHERE b.referee = u.login)`,
+		order.Username)
+	if err := row.Scan(&referrer); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("cannot select referrer: %w", err)
+	}
+	if referrer == nil {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE login IN ($1, $2) ORDER BY login FOR UPDATE`,
+		order.Username, *referrer)
+	if err != nil {
+		return fmt.Errorf("cannot lock users: %w", err)
+	}
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO referral_bonuses (referrer, referee, order_id, referrer_bonus, referee_bonus)
+			VALUES ($1, $2, $3, $4, $5) ON CONFLICT (referee) DO NOTHING`,
+		*referrer, order.Username, order.ID, db.referrerBonus, db.refereeBonus)
+	if err != nil {
+		return fmt.Errorf("cannot insert referral bonus: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	if err := db.creditPoints(ctx, tx, *referrer, db.referrerBonus, history.ReferralBonus, order.Username); err != nil {
+		return err
+	}
+	return db.creditPoints(ctx, tx, order.Username, db.refereeBonus, history.ReferralBonus, *referrer)
+}
+
+// SelectReferrals returns the user's referral code and the users they referred.
+func (db *DB) SelectReferrals(ctx context.Context, login string) (models.Referrals, error) {
+	res := models.Referrals{Referrals: []models.Referral{}}
+	row := db.pool.QueryRow(ctx, `SELECT referral_code FROM users WHERE login = $1`, login)
+	if err := row.Scan(&res.Code); err != nil {
+		return models.Referrals{}, fmt.Errorf("cannot select referral code: %w", err)
+	}
+
+	rows, err := db.pool.Query(ctx,
+		`SELECT b.created_at, u.login, COALESCE(b.referrer_bonus, 0), b.id IS NOT NULL
+			FROM users u LEFT JOIN referral_bonuses b ON b.referee = u.login
+			WHERE u.referred_by = $1 ORDER BY u.login`, login)
+	if err != nil {
+		return models.Referrals{}, fmt.Errorf("cannot select referrals: %w", err)
+	}
+	referrals, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.Referral])
+	if err != nil {
+		return models.Referrals{}, fmt.Errorf("cannot scan referrals: %w", err)
+	}
+	for _, r := range referrals {
+		res.Earned += r.Bonus
+	}
+	if len(referrals) > 0 {
+		res.Referrals = referrals
+	}
+	return res, nil
+}
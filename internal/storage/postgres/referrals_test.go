@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/reversal"
+	"github.com/ospiem/gophermart/internal/models/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedReferee registers referee with the referral code of referrer.
+func seedReferee(t *testing.T, db *DB, referrer string, referee string) {
+	t.Helper()
+	ctx := context.Background()
+	refs, err := db.SelectReferrals(ctx, referrer)
+	require.NoError(t, err)
+	require.NoError(t, db.InsertUser(ctx, referee, "hash", refs.Code))
+}
+
+func processOrder(t *testing.T, db *DB, login string, accrual float32) {
+	t.Helper()
+	ctx := context.Background()
+	id := uniqueOrder()
+	require.NoError(t, db.InsertOrder(ctx, models.Order{ID: id, Status: status.NEW, Username: login}))
+	require.NoError(t, db.ProcessOrderWithBonuses(ctx, models.Order{ID: id, Status: status.PROCESSED, Accrual: accrual}))
+}
+
+func TestReferralBonusNeedsAccrual(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	db.SetReferralBonuses(100, 50)
+	referrer, referee := uniqueLogin("referrer"), uniqueLogin("referee")
+	seedUser(t, db, referrer, 0)
+	seedReferee(t, db, referrer, referee)
+	cleanupUsers(t, db, referrer, referee)
+
+	processOrder(t, db, referee, 0)
+	refs, err := db.SelectReferrals(ctx, referrer)
+	require.NoError(t, err)
+	require.Len(t, refs.Referrals, 1)
+	assert.Zero(t, refs.Earned, "an order without accrual must not pay the referral bonus")
+	b, err := db.SelectUserBalance(ctx, referrer)
+	require.NoError(t, err)
+	assert.Zero(t, b.Balance)
+
+	processOrder(t, db, referee, 10)
+	refs, err = db.SelectReferrals(ctx, referrer)
+	require.NoError(t, err)
+	assert.InDelta(t, 100, refs.Earned, 0.001)
+	b, err = db.SelectUserBalance(ctx, referrer)
+	require.NoError(t, err)
+	assert.InDelta(t, 100, b.Balance, 0.001)
+
+	processOrder(t, db, referee, 10)
+	b, err = db.SelectUserBalance(ctx, referrer)
+	require.NoError(t, err)
+	assert.InDelta(t, 100, b.Balance, 0.001, "the bonus is paid once")
+}
+
+func TestReferralBonusReversed(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	db.SetReferralBonuses(100, 50)
+	referrer, referee := uniqueLogin("reversed_referrer"), uniqueLogin("reversed_referee")
+	seedUser(t, db, referrer, 0)
+	seedReferee(t, db, referrer, referee)
+	cleanupUsers(t, db, referrer, referee)
+
+	id := uniqueOrder()
+	require.NoError(t, db.InsertOrder(ctx, models.Order{ID: id, Status: status.NEW, Username: referee}))
+	require.NoError(t, db.ProcessOrderWithBonuses(ctx, models.Order{ID: id, Status: status.PROCESSED, Accrual: 10}))
+	_, err := db.ReverseOrder(ctx, models.Reversal{OrderID: id, Policy: reversal.Negative, Reason: "refund",
+		Actor: referee})
+	require.NoError(t, err)
+
+	for login, want := range map[string]float32{referrer: 0, referee: 0} {
+		b, err := db.SelectUserBalance(ctx, login)
+		require.NoError(t, err)
+		assert.InDelta(t, want, b.Balance, 0.001, "%s keeps a bonus of a reversed order", login)
+	}
+	refs, err := db.SelectReferrals(ctx, referrer)
+	require.NoError(t, err)
+	assert.Zero(t, refs.Earned)
+
+	processOrder(t, db, referee, 10)
+	b, err := db.SelectUserBalance(ctx, referrer)
+	require.NoError(t, err)
+	assert.InDelta(t, 100, b.Balance, 0.001, "the next accrual pays the bonus again")
+}
+
+func TestReferralCyclesRejected(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	a, b, c := uniqueLogin("cycle_a"), uniqueLogin("cycle_b"), uniqueLogin("cycle_c")
+	seedUser(t, db, a, 0)
+	seedReferee(t, db, a, b)
+	seedReferee(t, db, b, c)
+	cleanupUsers(t, db, a, b, c)
+
+	tests := []struct {
+		name     string
+		login    string
+		referrer string
+	}{
+		{name: "self", login: a, referrer: a},
+		{name: "direct", login: a, referrer: b},
+		{name: "through a chain", login: a, referrer: c},
+		{name: "inside the chain", login: b, referrer: c},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.pool.Exec(ctx, `UPDATE users SET referred_by = $1 WHERE login = $2`, tt.referrer, tt.login)
+			assert.Error(t, err)
+		})
+	}
+
+	refs, err := db.SelectReferrals(ctx, c)
+	require.NoError(t, err)
+	err = db.InsertUser(ctx, c, "hash", refs.Code)
+	assert.True(t, errors.Is(err, models.ErrReferralLoop), "got %v", err)
+}
@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/history"
+	"github.com/ospiem/gophermart/internal/models/reversal"
+	"github.com/ospiem/gophermart/internal/models/status"
+)
+
+const auditReverseOrder = "reverse_order"
+
+// ReverseOrder marks a processed order REVERSED and debits its accrual, including
+// any campaign bonus, from the owner according to rev.Policy. If the order paid
+// the referral bonuses, they are debited from both users as well and the referee's
+// next accrual pays them again. If rev.Username is
+// set, the order must belong to that user. It returns pgx.ErrNoRows when there
+// is no such order and models.ErrOrderNotReversible when the order is not PROCESSED.
+func (db *DB) ReverseOrder(ctx context.Context, rev models.Reversal) (models.Reversal, error) {
+	err := db.withTx(ctx, "ReverseOrder", func(tx pgx.Tx) error {
+		var owner string
+		var orderStatus status.Status
+		row := tx.QueryRow(ctx,
+			`SELECT username, status, COALESCE(accrual, 0) + bonus FROM orders WHERE id = $1 FOR UPDATE`, rev.OrderID)
+		if err := row.Scan(&owner, &orderStatus, &rev.Accrual); err != nil {
+			return fmt.Errorf("cannot lock order: %w", err)
+		}
+		if rev.Username != "" && rev.Username != owner {
+			return fmt.Errorf("order belongs to another user: %w", pgx.ErrNoRows)
+		}
+		if orderStatus != status.PROCESSED {
+			return models.ErrOrderNotReversible
+		}
+		rev.Username = owner
+
+		bonus, err := lockReferralBonus(ctx, tx, rev.OrderID)
+		if err != nil {
+			return err
+		}
+		rev.Debited, rev.Shortfall, err = debitReversal(ctx, tx, owner, rev.Accrual, rev.Policy, rev.OrderID,
+			rev.Reason)
+		if err != nil {
+			return err
+		}
+		if err := updateWithRetry(ctx, tx, `UPDATE orders SET status = $1 WHERE id = $2`,
+			status.REVERSED, rev.OrderID); err != nil {
+			return fmt.Errorf("cannot update order status: %w", err)
+		}
+
+		row = tx.QueryRow(ctx,
+			`INSERT INTO order_reversals (order_id, username, accrual, debited, shortfall, policy, reason, actor)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING created_at`,
+			rev.OrderID, owner, rev.Accrual, rev.Debited, rev.Shortfall, rev.Policy, rev.Reason, rev.Actor)
+		if err := row.Scan(&rev.CreatedAt); err != nil {
+			return fmt.Errorf("cannot insert reversal: %w", err)
+		}
+
+		if bonus != nil {
+			if err := reverseReferralBonus(ctx, tx, *bonus, rev.Policy, rev.Reason); err != nil {
+				return err
+			}
+		}
+		if err := db.recalculateTier(ctx, tx, owner); err != nil {
+			return err
+		}
+		if !rev.ByAdmin {
+			return nil
+		}
+		return insertAuditRecord(ctx, tx, models.AuditRecord{
+			Admin:  rev.Actor,
+			Action: auditReverseOrder,
+			Target: rev.OrderID,
+			Reason: rev.Reason,
+		})
+	})
+	if err != nil {
+		return models.Reversal{}, err
+	}
+	return rev, nil
+}
+
+// debitReversal debits amount from the user according to policy and records it
+// in the balance history. It returns the debited amount and the shortfall.
+func debitReversal(ctx context.Context, tx pgx.Tx, login string, amount float32, policy reversal.Policy,
+	reference string, comment string) (float32, float32, error) {
+	balance, err := lockUserBalance(ctx, tx, login)
+	if err != nil {
+		return 0, 0, err
+	}
+	debited, shortfall := reversal.Debit(policy, balance, amount)
+	var debt float32
+	if policy == reversal.Block {
+		debt = shortfall
+	}
+
+	err = updateWithRetry(ctx, tx,
+		`UPDATE users SET balance = COALESCE(balance, 0) - $1, points_debt = points_debt + $2 WHERE login = $3`,
+		debited, debt, login)
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot update user's balance: %w", err)
+	}
+	if _, err := consumeLots(ctx, tx, login, debited); err != nil {
+		return 0, 0, err
+	}
+	err = insertHistory(ctx, tx, models.HistoryEntry{
+		Username:  login,
+		Kind:      history.Reversal,
+		Amount:    -debited,
+		Reference: reference,
+		Comment:   comment,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return debited, shortfall, nil
+}
+
+type referralBonus struct {
+	ID            string
+	Referrer      string
+	Referee       string
+	ReferrerBonus float32
+	RefereeBonus  float32
+}
+
+// lockReferralBonus locks the referral bonuses paid for the order, if any, and
+// both users in login order, the order creditReferralBonus locks them in.
+func lockReferralBonus(ctx context.Context, tx pgx.Tx, orderID string) (*referralBonus, error) {
+	rows, err := tx.Query(ctx,
+		`SELECT id, referrer, referee, referrer_bonus, referee_bonus FROM referral_bonuses
+			WHERE order_id = $1 FOR UPDATE`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot lock referral bonus: %w", err)
+	}
+	bonus, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByPos[referralBonus])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot scan referral bonus: %w", err)
+	}
+	_, err = tx.Exec(ctx, `SELECT 1 FROM users WHERE login IN ($1, $2) ORDER BY login FOR UPDATE`,
+		bonus.Referrer, bonus.Referee)
+	if err != nil {
+		return nil, fmt.Errorf("cannot lock users: %w", err)
+	}
+	return bonus, nil
+}
+
+// reverseReferralBonus takes the referral bonuses back from both users. The
+// bonus row goes too, so that the referee's next accrual pays the bonuses again.
+func reverseReferralBonus(ctx context.Context, tx pgx.Tx, b referralBonus, policy reversal.Policy,
+	reason string) error {
+	if err := updateWithRetry(ctx, tx, `DELETE FROM referral_bonuses WHERE id = $1`, b.ID); err != nil {
+		return fmt.Errorf("cannot delete referral bonus: %w", err)
+	}
+	if _, _, err := debitReversal(ctx, tx, b.Referrer, b.ReferrerBonus, policy, b.Referee, reason); err != nil {
+		return err
+	}
+	_, _, err := debitReversal(ctx, tx, b.Referee, b.RefereeBonus, policy, b.Referrer, reason)
+	return err
+}
@@ -0,0 +1,147 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/history"
+	"github.com/ospiem/gophermart/internal/models/status"
+	"github.com/ospiem/gophermart/internal/models/tier"
+)
+
+// tierCheckInterval is how often RecalculateTiers revisits a user whose
+// lifetime accrual may have left the rolling window.
+const tierCheckInterval = 24 * time.Hour
+
+// SetTierRules sets the loyalty tier thresholds and perks.
+func (db *DB) SetTierRules(rules tier.Rules) {
+	db.tiers = rules
+}
+
+// lifetimeAccrual sums the base accrual of the user's processed orders within
+// the rolling tier window. Reversed orders do not count.
+func (db *DB) lifetimeAccrual(ctx context.Context, tx pgx.Tx, login string) (float32, error) {
+	var lifetime float32
+	row := tx.QueryRow(ctx,
+		`SELECT COALESCE(SUM(h.amount), 0) FROM balance_history h JOIN orders o ON o.id = h.reference
+			WHERE h.username = $1 AND h.kind = $2 AND o.status = $3 AND h.created_at >= now() - $4::interval`,
+		login, history.Accrual, status.PROCESSED, db.tiers.Window)
+	if err := row.Scan(&lifetime); err != nil {
+		return 0, fmt.Errorf("cannot sum lifetime accrual: %w", err)
+	}
+	return lifetime, nil
+}
+
+// recalculateTier moves the user to the tier their lifetime accrual reaches
+// and records the change, if any.
+func (db *DB) recalculateTier(ctx context.Context, tx pgx.Tx, login string) error {
+	var current tier.Tier
+	row := tx.QueryRow(ctx, `SELECT tier FROM users WHERE login = $1 FOR UPDATE`, login)
+	if err := row.Scan(&current); err != nil {
+		return fmt.Errorf("cannot lock user: %w", err)
+	}
+	lifetime, err := db.lifetimeAccrual(ctx, tx, login)
+	if err != nil {
+		return err
+	}
+	level := db.tiers.For(lifetime)
+
+	err = updateWithRetry(ctx, tx, `UPDATE users SET tier = $1, tier_checked_at = now() WHERE login = $2`,
+		level.Name, login)
+	if err != nil {
+		return fmt.Errorf("cannot update user's tier: %w", err)
+	}
+	if level.Name == current {
+		return nil
+	}
+	err = updateWithRetry(ctx, tx,
+		`INSERT INTO tier_changes (username, from_tier, to_tier, lifetime) VALUES ($1, $2, $3, $4)`,
+		login, current, level.Name, lifetime)
+	if err != nil {
+		return fmt.Errorf("cannot insert tier change: %w", err)
+	}
+	return nil
+}
+
+// RecalculateTiers revisits a batch of users above the lowest tier whose
+// accruals may have aged out of the window and returns how many were checked.
+func (db *DB) RecalculateTiers(ctx context.Context) (int, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT login FROM users WHERE tier != $1 AND tier_checked_at < now() - $2::interval
+			ORDER BY tier_checked_at LIMIT $3`,
+		tier.Bronze, tierCheckInterval, expiryBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("cannot select users to recalculate tiers: %w", err)
+	}
+	logins, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, fmt.Errorf("cannot scan users to recalculate tiers: %w", err)
+	}
+	for _, login := range logins {
+		err := db.withTx(ctx, "RecalculateTiers", func(tx pgx.Tx) error {
+			return db.recalculateTier(ctx, tx, login)
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(logins), nil
+}
+
+// creditTierBonus credits the tier multiplier's share of the order's accrual
+// and returns it. The caller must hold the lock on the user's row.
+func (db *DB) creditTierBonus(ctx context.Context, tx pgx.Tx, order models.Order) (float32, error) {
+	var t tier.Tier
+	row := tx.QueryRow(ctx, `SELECT tier FROM users WHERE login = $1`, order.Username)
+	if err := row.Scan(&t); err != nil {
+		return 0, fmt.Errorf("cannot select user's tier: %w", err)
+	}
+	multiplier := db.tiers.Level(t).Perks.Multiplier
+	if multiplier <= 1 {
+		return 0, nil
+	}
+	bonus := order.Accrual * (multiplier - 1)
+	if err := db.creditPoints(ctx, tx, order.Username, bonus, history.TierBonus, order.ID); err != nil {
+		return 0, err
+	}
+	return bonus, nil
+}
+
+// SelectTierStatus returns the user's tier, its perks and the tier changes so far.
+func (db *DB) SelectTierStatus(ctx context.Context, login string) (models.TierStatus, error) {
+	ts := models.TierStatus{}
+	err := db.withTx(ctx, "SelectTierStatus", func(tx pgx.Tx) error {
+		row := tx.QueryRow(ctx, `SELECT tier FROM users WHERE login = $1`, login)
+		if err := row.Scan(&ts.Tier); err != nil {
+			return fmt.Errorf("cannot select user's tier: %w", err)
+		}
+		var err error
+		if ts.Lifetime, err = db.lifetimeAccrual(ctx, tx, login); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx,
+			`SELECT created_at, from_tier, to_tier, lifetime FROM tier_changes
+				WHERE username = $1 ORDER BY created_at DESC`, login)
+		if err != nil {
+			return fmt.Errorf("cannot select tier changes: %w", err)
+		}
+		ts.Changes, err = pgx.CollectRows(rows, pgx.RowToStructByPos[models.TierChange])
+		if err != nil {
+			return fmt.Errorf("cannot scan tier changes: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.TierStatus{}, err
+	}
+
+	ts.Perks = db.tiers.Level(ts.Tier).Perks
+	if next, ok := db.tiers.Next(ts.Tier); ok {
+		ts.Next = &next
+	}
+	return ts, nil
+}
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ospiem/gophermart/internal/models/tier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTiers(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	db.SetTierRules(tier.Rules{Window: time.Hour, Levels: []tier.Level{
+		{Name: tier.Bronze, Perks: tier.Perks{Multiplier: 1}},
+		{Name: tier.Silver, Threshold: 100, Perks: tier.Perks{Multiplier: 1.5}},
+		{Name: tier.Gold, Threshold: 1000, Perks: tier.Perks{Multiplier: 2}},
+	}})
+	login := uniqueLogin("tier_test")
+	seedUser(t, db, login, 0)
+	cleanupUsers(t, db, login)
+
+	tests := []struct {
+		name        string
+		wantTier    tier.Tier
+		accrual     float32
+		wantBalance float32
+		wantChanges int
+	}{
+		{name: "below silver", accrual: 50, wantTier: tier.Bronze, wantBalance: 50},
+		{name: "reaches silver without a bonus", accrual: 60, wantTier: tier.Silver, wantBalance: 110, wantChanges: 1},
+		{name: "silver bonus", accrual: 100, wantTier: tier.Silver, wantBalance: 260, wantChanges: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processOrder(t, db, login, tt.accrual)
+
+			ts, err := db.SelectTierStatus(ctx, login)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantTier, ts.Tier)
+			assert.Len(t, ts.Changes, tt.wantChanges)
+			b, err := db.SelectUserBalance(ctx, login)
+			require.NoError(t, err)
+			assert.InDelta(t, tt.wantBalance, b.Balance, 0.001)
+		})
+	}
+
+	ts, err := db.SelectTierStatus(ctx, login)
+	require.NoError(t, err)
+	assert.InDelta(t, 210, ts.Lifetime, 0.001, "tier bonuses do not count as lifetime accrual")
+
+	_, err = db.pool.Exec(ctx, `UPDATE balance_history SET created_at = created_at - interval '2 hours'
+		WHERE username = $1`, login)
+	require.NoError(t, err)
+	_, err = db.pool.Exec(ctx, `UPDATE users SET tier_checked_at = now() - interval '2 days' WHERE login = $1`, login)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		n, err := db.RecalculateTiers(ctx)
+		require.NoError(t, err)
+		if n == 0 {
+			break
+		}
+	}
+
+	ts, err = db.SelectTierStatus(ctx, login)
+	require.NoError(t, err)
+	assert.Equal(t, tier.Bronze, ts.Tier, "accruals out of the window no longer count")
+	require.Len(t, ts.Changes, 2)
+	assert.Equal(t, tier.Silver, ts.Changes[0].From)
+	assert.Equal(t, tier.Bronze, ts.Changes[0].To)
+}
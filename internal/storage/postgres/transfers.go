@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/history"
+)
+
+// Transfer moves t.Sum points from t.From to t.To. A positive dailyLimit caps
+// how much a user may send per calendar day. It returns pgx.ErrNoRows when
+// the recipient does not exist.
+func (db *DB) Transfer(ctx context.Context, t models.Transfer, dailyLimit float32) (models.Transfer, error) {
+	if t.From == t.To {
+		return models.Transfer{}, models.ErrSelfTransfer
+	}
+	err := db.withTx(ctx, "Transfer", func(tx pgx.Tx) error {
+		// Both rows are locked in login order, so opposing transfers cannot deadlock.
+		rows, err := tx.Query(ctx,
+			`SELECT login, COALESCE(balance, 0), points_debt FROM users
+				WHERE login IN ($1, $2) ORDER BY login FOR UPDATE`, t.From, t.To)
+		if err != nil {
+			return fmt.Errorf("cannot lock users: %w", err)
+		}
+		type account struct {
+			Login   string
+			Balance float32
+			Debt    float32
+		}
+		accounts, err := pgx.CollectRows(rows, pgx.RowToStructByPos[account])
+		if err != nil {
+			return fmt.Errorf("cannot scan users: %w", err)
+		}
+		if len(accounts) != 2 {
+			return fmt.Errorf("cannot find recipient: %w", pgx.ErrNoRows)
+		}
+		sender := accounts[0]
+		if sender.Login != t.From {
+			sender = accounts[1]
+		}
+		if sender.Debt > 0 {
+			return models.ErrWithdrawalsBlocked
+		}
+		if sender.Balance < t.Sum {
+			return models.ErrInsufficientBalance
+		}
+
+		if dailyLimit > 0 {
+			var sent float32
+			row := tx.QueryRow(ctx,
+				`SELECT COALESCE(SUM(amount), 0) FROM transfers
+					WHERE sender = $1 AND created_at >= date_trunc('day', now())`, t.From)
+			if err := row.Scan(&sent); err != nil {
+				return fmt.Errorf("cannot select sent points: %w", err)
+			}
+			if sent+t.Sum > dailyLimit {
+				return models.ErrTransferLimitExceeded
+			}
+		}
+
+		for _, u := range []struct {
+			login string
+			delta float32
+		}{{t.From, -t.Sum}, {t.To, t.Sum}} {
+			err := updateWithRetry(ctx, tx, `UPDATE users SET balance = COALESCE(balance, 0) + $1 WHERE login = $2`,
+				u.delta, u.login)
+			if err != nil {
+				return fmt.Errorf("cannot update user's balance: %w", err)
+			}
+		}
+
+		row := tx.QueryRow(ctx,
+			`INSERT INTO transfers (sender, recipient, amount) VALUES ($1, $2, $3) RETURNING id, created_at`,
+			t.From, t.To, t.Sum)
+		if err := row.Scan(&t.ID, &t.CreatedAt); err != nil {
+			return fmt.Errorf("cannot insert transfer: %w", err)
+		}
+
+		// Transferred points keep the earliest expiry of the sender's lots they came from.
+		expiresAt, err := consumeLots(ctx, tx, t.From, t.Sum)
+		if err != nil {
+			return err
+		}
+		if err := insertLot(ctx, tx, t.To, t.Sum, t.ID, expiresAt); err != nil {
+			return err
+		}
+
+		for _, e := range []models.HistoryEntry{
+			{Username: t.From, Kind: history.TransferOut, Amount: -t.Sum, Reference: t.To},
+			{Username: t.To, Kind: history.TransferIn, Amount: t.Sum, Reference: t.From},
+		} {
+			if err := insertHistory(ctx, tx, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Transfer{}, err
+	}
+	return t, nil
+}
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDB connects to the database from TEST_DATABASE_URI and skips the test
+// when it is not set.
+func testDB(t *testing.T) *DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+	db, err := NewDB(context.Background(), dsn)
+	require.NoError(t, err)
+	t.Cleanup(db.Close)
+	return db
+}
+
+func seedUser(t *testing.T, db *DB, login string, balance float32) {
+	t.Helper()
+	ctx := context.Background()
+	_, err := db.pool.Exec(ctx, `DELETE FROM users WHERE login = $1`, login)
+	require.NoError(t, err)
+	require.NoError(t, db.InsertUser(ctx, login, "hash", ""))
+	err = db.withTx(ctx, "seedUser", func(tx pgx.Tx) error {
+		if err := updateWithRetry(ctx, tx, `UPDATE users SET balance = $1 WHERE login = $2`, balance, login); err != nil {
+			return err
+		}
+		return insertLot(ctx, tx, login, balance, "seed", nil)
+	})
+	require.NoError(t, err)
+}
+
+func TestTransferOpposingDirections(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	alice, bob := uniqueLogin("transfer_alice"), uniqueLogin("transfer_bob")
+	seedUser(t, db, alice, 1000)
+	seedUser(t, db, bob, 1000)
+	cleanupUsers(t, db, alice, bob)
+
+	const transfers = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*transfers)
+	for i := 0; i < transfers; i++ {
+		for _, tr := range []models.Transfer{{From: alice, To: bob, Sum: 3}, {From: bob, To: alice, Sum: 2}} {
+			wg.Add(1)
+			go func(tr models.Transfer) {
+				defer wg.Done()
+				_, err := db.Transfer(ctx, tr, 0)
+				errs <- err
+			}(tr)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	a, err := db.SelectUserBalance(ctx, alice)
+	require.NoError(t, err)
+	b, err := db.SelectUserBalance(ctx, bob)
+	require.NoError(t, err)
+	assert.InDelta(t, 1000-transfers, a.Balance, 0.01)
+	assert.InDelta(t, 1000+transfers, b.Balance, 0.01)
+}
+
+func TestTransferRejections(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	alice, bob := uniqueLogin("transfer_carol"), uniqueLogin("transfer_dave")
+	seedUser(t, db, alice, 100)
+	seedUser(t, db, bob, 0)
+	cleanupUsers(t, db, alice, bob)
+
+	tests := []struct {
+		want     error
+		name     string
+		transfer models.Transfer
+		limit    float32
+	}{
+		{name: "self", transfer: models.Transfer{From: alice, To: alice, Sum: 1}, want: models.ErrSelfTransfer},
+		{name: "unknown recipient", transfer: models.Transfer{From: alice, To: uniqueLogin("transfer_nobody"), Sum: 1},
+			want: pgx.ErrNoRows},
+		{name: "insufficient", transfer: models.Transfer{From: bob, To: alice, Sum: 1},
+			want: models.ErrInsufficientBalance},
+		{name: "daily limit", transfer: models.Transfer{From: alice, To: bob, Sum: 60}, limit: 50,
+			want: models.ErrTransferLimitExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.Transfer(ctx, tt.transfer, tt.limit)
+			assert.True(t, errors.Is(err, tt.want), "got %v", err)
+		})
+	}
+}
@@ -0,0 +1,161 @@
+// Package tlsutil builds the TLS settings of the HTTP server and the accrual
+// client and keeps their certificates up to date with the files on disk.
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// watchInterval is how often Watch looks for changed certificate files.
+const watchInterval = 10 * time.Second
+
+var ErrNoCertificates = errors.New("no certificates found")
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseVersion converts a TLS version such as "1.2" to its crypto/tls value.
+func ParseVersion(s string) (uint16, error) {
+	v, ok := versions[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q", s)
+	}
+	return v, nil
+}
+
+// Certificate is a key pair loaded from files. It loads the pair again when
+// either file changes, so that renewed certificates apply without a restart.
+type Certificate struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+func LoadCertificate(certFile, keyFile string) (*Certificate, error) {
+	c := &Certificate{certFile: certFile, keyFile: keyFile}
+	if _, err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload loads the key pair if either file has changed since the last load and
+// reports whether it did. The current pair stays in use if loading fails.
+func (c *Certificate) Reload() (bool, error) {
+	var modTimes [2]time.Time
+	for i, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return false, fmt.Errorf("cannot stat certificate file: %w", err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+
+	c.mu.RLock()
+	unchanged := c.cert != nil && c.modTimes == modTimes
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("cannot load key pair: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.modTimes = modTimes
+	return true, nil
+}
+
+// Watch reloads the key pair when its files change until ctx is done.
+func (c *Certificate) Watch(ctx context.Context, wg *sync.WaitGroup, l *zerolog.Logger) {
+	logger := l.With().Str("func", "Watch").Str("cert", c.certFile).Logger()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Info().Msg("Stopped certificate watcher")
+				return
+			case <-ticker.C:
+			}
+
+			reloaded, err := c.Reload()
+			if err != nil {
+				logger.Error().Err(err).Msg("cannot reload certificate")
+				continue
+			}
+			if reloaded {
+				logger.Info().Msg("Certificate has been reloaded")
+			}
+		}
+	}()
+}
+
+func (c *Certificate) current() *tls.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert
+}
+
+// GetCertificate serves the current pair as tls.Config.GetCertificate.
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.current(), nil
+}
+
+// GetClientCertificate serves the current pair as tls.Config.GetClientCertificate.
+func (c *Certificate) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return c.current(), nil
+}
+
+// ServerConfig returns the settings of a server presenting cert.
+func ServerConfig(cert *Certificate, minVersion uint16) *tls.Config {
+	return &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: cert.GetCertificate,
+	}
+}
+
+// ClientConfig returns the settings of a client presenting cert, if not nil,
+// and trusting the CAs in caFile, if set, instead of the system ones.
+func ClientConfig(cert *Certificate, caFile string, minVersion uint16) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: minVersion}
+	if cert != nil {
+		cfg.GetClientCertificate = cert.GetClientCertificate
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("cannot parse CA bundle %s: %w", caFile, ErrNoCertificates)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
@@ -0,0 +1,236 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+var serial int64
+
+// newAuthority generates a self-signed CA and writes its certificate to dir.
+func newAuthority(t *testing.T, dir string) authority {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial++
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	file := filepath.Join(dir, "ca.pem")
+	writePEM(t, file, "CERTIFICATE", der)
+	return authority{cert: cert, key: key, file: file}
+}
+
+// issue writes a key pair signed by ca to dir and returns the file names.
+func (ca authority) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, name, kind string, der []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0o600))
+}
+
+func leafSerial(t *testing.T, c *Certificate) *big.Int {
+	t.Helper()
+	cert, err := c.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.SerialNumber
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint16
+		wantErr bool
+	}{
+		{in: "1.2", want: tls.VersionTLS12},
+		{in: "1.3", want: tls.VersionTLS13},
+		{in: "1.4", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseVersion(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newAuthority(t, dir)
+	certFile, keyFile := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+
+	c, err := LoadCertificate(certFile, keyFile)
+	require.NoError(t, err)
+	first := leafSerial(t, c)
+
+	reloaded, err := c.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "files have not changed")
+
+	ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	reloaded, err = c.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	second := leafSerial(t, c)
+	assert.NotEqual(t, first, second)
+
+	require.NoError(t, os.WriteFile(keyFile, []byte("garbage"), 0o600))
+	_, err = c.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, second, leafSerial(t, c), "a broken pair must not replace the current one")
+
+	_, err = LoadCertificate(filepath.Join(dir, "missing.pem"), keyFile)
+	assert.Error(t, err)
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newAuthority(t, dir)
+	serverCert, serverKey := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, dir, "client", x509.ExtKeyUsageClientAuth)
+
+	tests := []struct {
+		name          string
+		mutual        bool
+		withClient    bool
+		caFile        string
+		serverVersion uint16
+		clientMax     uint16
+		wantErr       bool
+	}{
+		{name: "server certificate", caFile: ca.file},
+		{name: "mutual", mutual: true, withClient: true, caFile: ca.file},
+		{name: "mutual without client certificate", mutual: true, caFile: ca.file, wantErr: true},
+		{name: "unknown authority", wantErr: true},
+		{name: "version below minimum", caFile: ca.file, serverVersion: tls.VersionTLS13,
+			clientMax: tls.VersionTLS12, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := LoadCertificate(serverCert, serverKey)
+			require.NoError(t, err)
+			version := tt.serverVersion
+			if version == 0 {
+				version = tls.VersionTLS12
+			}
+			srv := &http.Server{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusNoContent)
+				}),
+				TLSConfig:         ServerConfig(cert, version),
+				ReadHeaderTimeout: time.Second,
+				ErrorLog:          log.New(io.Discard, "", 0),
+			}
+			if tt.mutual {
+				srv.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+				srv.TLSConfig.ClientCAs = x509.NewCertPool()
+				srv.TLSConfig.ClientCAs.AddCert(ca.cert)
+			}
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			// The server is served the way gophermart serves it, with the
+			// certificate coming from the TLS settings only.
+			go func() { _ = srv.ServeTLS(ln, "", "") }()
+			defer func() { _ = srv.Close() }()
+
+			var client *Certificate
+			if tt.withClient {
+				client, err = LoadCertificate(clientCert, clientKey)
+				require.NoError(t, err)
+			}
+			cfg, err := ClientConfig(client, tt.caFile, tls.VersionTLS12)
+			require.NoError(t, err)
+			cfg.MaxVersion = tt.clientMax
+
+			c := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+			resp, err := c.Get("https://" + ln.Addr().String())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, resp.Body.Close())
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		})
+	}
+}
+
+func TestClientConfigBadCA(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.pem")
+	require.NoError(t, os.WriteFile(bad, []byte("not a certificate"), 0o600))
+
+	_, err := ClientConfig(nil, bad, tls.VersionTLS12)
+	assert.ErrorIs(t, err, ErrNoCertificates)
+	_, err = ClientConfig(nil, filepath.Join(dir, "missing.pem"), tls.VersionTLS12)
+	assert.Error(t, err)
+}
@@ -0,0 +1,30 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// LogHook adds the trace and span IDs to log events that carry a traced
+// context, see zerolog.Event.Ctx.
+type LogHook struct{}
+
+func (LogHook) Run(e *zerolog.Event, _ zerolog.Level, _ string) {
+	sc := trace.SpanContextFromContext(e.GetCtx())
+	if !sc.IsValid() {
+		return
+	}
+	e.Str("trace_id", sc.TraceID().String()).Str("span_id", sc.SpanID().String())
+}
+
+// WithIDs adds the trace and span IDs of ctx, if it is traced, to a logger
+// context.
+func WithIDs(ctx context.Context, c zerolog.Context) zerolog.Context {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return c
+	}
+	return c.Str("trace_id", sc.TraceID().String()).Str("span_id", sc.SpanID().String())
+}
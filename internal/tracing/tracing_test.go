@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	testCases := []struct {
+		name        string
+		path        string
+		traceparent string
+		wantName    string
+		wantRemote  bool
+	}{
+		{name: "new trace", path: "/orders/1", wantName: "GET /orders/{id}"},
+		{name: "continued trace", path: "/orders/1", traceparent: parent, wantName: "GET /orders/{id}",
+			wantRemote: true},
+		{name: "unmatched route", path: "/unknown", wantName: "GET"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := recordSpans(t)
+			r := chi.NewRouter()
+			r.Use(Middleware)
+			r.Get("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+				assert.True(t, trace.SpanContextFromContext(r.Context()).IsValid())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.traceparent != "" {
+				req.Header.Set("traceparent", tc.traceparent)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := rec.Ended()
+			require.Len(t, spans, 1)
+			assert.Equal(t, tc.wantName, spans[0].Name())
+			assert.Equal(t, tc.wantRemote, spans[0].Parent().IsRemote())
+		})
+	}
+}
+
+func TestInject(t *testing.T) {
+	recordSpans(t)
+	ctx, span := Start(context.Background(), "test")
+	defer span.End()
+
+	h := http.Header{}
+	Inject(ctx, h)
+	assert.Contains(t, h.Get("traceparent"), span.SpanContext().TraceID().String())
+}
+
+func TestLogHook(t *testing.T) {
+	recordSpans(t)
+	ctx, span := Start(context.Background(), "test")
+	defer span.End()
+
+	var buf bytes.Buffer
+	l := zerolog.New(&buf).Hook(LogHook{})
+	l.Info().Msg("untraced")
+	assert.NotContains(t, buf.String(), "trace_id")
+
+	buf.Reset()
+	l.Info().Ctx(ctx).Msg("traced")
+	assert.Contains(t, buf.String(), `"trace_id":"`+span.SpanContext().TraceID().String()+`"`)
+}
@@ -0,0 +1,284 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/auth"
+	"github.com/rs/zerolog"
+)
+
+const defaultAdminLimit = 50
+const maxAdminLimit = 500
+const userNotFound = "User not found"
+const orderNotFound = "Order not found"
+const orderReversed = "Order has been reversed"
+
+const (
+	auditBlockUser       = "block_user"
+	auditUnblockUser     = "unblock_user"
+	auditRepollOrder     = "repoll_order"
+	auditInvalidateOrder = "invalidate_order"
+	auditRevokeAPIKey    = "revoke_api_key"
+)
+
+func (a *API) registerAdminAPI(r chi.Router) {
+	r.Get("/users", a.adminSearchUsers)
+	r.Route("/users/{login}", func(r chi.Router) {
+		r.Get("/", a.adminGetUser)
+		r.Get("/orders", a.adminGetUserOrders)
+		r.Get("/withdrawals", a.adminGetUserWithdrawals)
+		r.Get("/api-keys", a.adminGetUserAPIKeys)
+		r.Delete("/api-keys/{id}", a.adminRevokeAPIKey)
+		r.Post("/block", a.adminBlockUser)
+		r.Post("/unblock", a.adminUnblockUser)
+		r.Post("/unflag", a.adminClearFraudFlag)
+		r.Get("/adjustments", a.adminGetAdjustments)
+		r.Post("/adjustments", a.adminAdjustBalance)
+	})
+	r.Post("/orders/{id}/repoll", a.adminRepollOrder)
+	r.Post("/orders/{id}/invalidate", a.adminInvalidateOrder)
+	r.Post("/orders/{id}/reverse", a.adminReverseOrder)
+	r.Get("/audit", a.adminGetAudit)
+	r.Get("/fraud", a.adminGetFraudFlags)
+	r.Get("/withdrawals/pending", a.adminGetPendingWithdrawals)
+	r.Post("/withdrawals/{id}/approve", a.adminApproveWithdrawal)
+	r.Post("/withdrawals/{id}/reject", a.adminRejectWithdrawal)
+	r.Get("/campaigns", a.adminGetCampaigns)
+	r.Post("/campaigns", a.adminCreateCampaign)
+	r.Post("/campaigns/{id}/end", a.adminEndCampaign)
+}
+
+func (a *API) adminSearchUsers(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminSearchUsers").Logger()
+
+	users, err := a.storage.SearchUsers(r.Context(), r.URL.Query().Get("q"), adminLimit(r))
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot search users")
+		return
+	}
+	encodeJSON(w, users, logger)
+}
+
+func (a *API) adminGetUser(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminGetUser").Logger()
+
+	user, err := a.storage.SelectUserInfo(r.Context(), chi.URLParam(r, "login"))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, userNotFound, http.StatusNotFound)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg(cannotGetUser)
+		return
+	}
+	encodeJSON(w, user, logger)
+}
+
+func (a *API) adminGetUserOrders(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminGetUserOrders").Logger()
+
+	orders, err := a.storage.SelectOrders(r.Context(), chi.URLParam(r, "login"))
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot get orders")
+		return
+	}
+	encodeJSON(w, orders, logger)
+}
+
+func (a *API) adminGetUserWithdrawals(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminGetUserWithdrawals").Logger()
+
+	withdraws, err := a.storage.SelectWithdraws(r.Context(), chi.URLParam(r, "login"))
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot get withdraws")
+		return
+	}
+	encodeJSON(w, withdraws, logger)
+}
+
+func (a *API) adminGetUserAPIKeys(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminGetUserAPIKeys").Logger()
+
+	keys, err := a.storage.SelectAPIKeys(r.Context(), chi.URLParam(r, "login"))
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot get api keys")
+		return
+	}
+	encodeJSON(w, keys, logger)
+}
+
+func (a *API) adminRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminRevokeAPIKey").Logger()
+
+	login := chi.URLParam(r, "login")
+	id := chi.URLParam(r, "id")
+	rec, ok := a.auditRecord(w, r, auditRevokeAPIKey, login+"/"+id)
+	if !ok {
+		return
+	}
+	if err := a.storage.AdminRevokeAPIKey(r.Context(), login, id, rec); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot revoke api key")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) adminBlockUser(w http.ResponseWriter, r *http.Request) {
+	a.setUserBlocked(w, r, true)
+}
+
+func (a *API) adminUnblockUser(w http.ResponseWriter, r *http.Request) {
+	a.setUserBlocked(w, r, false)
+}
+
+func (a *API) setUserBlocked(w http.ResponseWriter, r *http.Request, blocked bool) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "setUserBlocked").Logger()
+	ctx := r.Context()
+
+	login := chi.URLParam(r, "login")
+	action := auditUnblockUser
+	if blocked {
+		action = auditBlockUser
+	}
+	rec, ok := a.auditRecord(w, r, action, login)
+	if !ok {
+		return
+	}
+
+	if _, err := a.storage.SelectUserInfo(ctx, login); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, userNotFound, http.StatusNotFound)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg(cannotGetUser)
+		return
+	}
+	if err := a.storage.SetUserBlocked(ctx, login, blocked, rec); err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot update user")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (a *API) adminRepollOrder(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminRepollOrder").Logger()
+
+	id := chi.URLParam(r, "id")
+	rec, ok := a.auditRecord(w, r, auditRepollOrder, id)
+	if !ok {
+		return
+	}
+	if err := a.storage.RepollOrder(r.Context(), id, rec); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, orderNotFound, http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, models.ErrOrderReversed) {
+			http.Error(w, orderReversed, http.StatusConflict)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot repoll order")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *API) adminInvalidateOrder(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminInvalidateOrder").Logger()
+
+	id := chi.URLParam(r, "id")
+	rec, ok := a.auditRecord(w, r, auditInvalidateOrder, id)
+	if !ok {
+		return
+	}
+	if err := a.storage.InvalidateOrder(r.Context(), id, rec); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, orderNotFound, http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, models.ErrOrderReversed) {
+			http.Error(w, orderReversed, http.StatusConflict)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot invalidate order")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (a *API) adminGetAudit(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminGetAudit").Logger()
+
+	records, err := a.storage.SelectAuditRecords(r.Context(), adminLimit(r))
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot get audit records")
+		return
+	}
+	encodeJSON(w, records, logger)
+}
+
+// auditRecord reads the mandatory reason of an admin action from the request body.
+// It writes an error response and returns false if the reason is missing.
+func (a *API) auditRecord(w http.ResponseWriter, r *http.Request, action string,
+	target string) (models.AuditRecord, bool) {
+	if r.Header.Get(contentType) != applicationJSON {
+		http.Error(w, invalitContentTypeNotJSON, http.StatusBadRequest)
+		return models.AuditRecord{}, false
+	}
+	admin, ok := r.Context().Value(auth.ContextLoginKey).(string)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return models.AuditRecord{}, false
+	}
+	body := models.AdminAction{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Reason == "" {
+		http.Error(w, "Reason is required", http.StatusBadRequest)
+		return models.AuditRecord{}, false
+	}
+	return models.AuditRecord{
+		Admin:  admin,
+		Action: action,
+		Target: target,
+		Reason: body.Reason,
+	}, true
+}
+
+func adminLimit(r *http.Request) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		return defaultAdminLimit
+	}
+	if limit > maxAdminLimit {
+		return maxAdminLimit
+	}
+	return limit
+}
+
+func encodeJSON(w http.ResponseWriter, v any, logger zerolog.Logger) {
+	w.Header().Set(contentType, applicationJSON)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot encode response")
+	}
+}
@@ -0,0 +1,201 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/role"
+	"github.com/stretchr/testify/assert"
+)
+
+// auditStorage records the audit records the admin actions pass to the storage.
+type auditStorage struct {
+	Storage
+	records []models.AuditRecord
+}
+
+func (s *auditStorage) audit(rec models.AuditRecord) error {
+	s.records = append(s.records, rec)
+	return nil
+}
+
+func (s *auditStorage) SelectTokenVersion(context.Context, string) (int, error) {
+	return 0, nil
+}
+
+func (s *auditStorage) SelectUserInfo(_ context.Context, login string) (models.UserInfo, error) {
+	return models.UserInfo{Login: login}, nil
+}
+
+func (s *auditStorage) SetUserBlocked(_ context.Context, _ string, _ bool, rec models.AuditRecord) error {
+	return s.audit(rec)
+}
+
+func (s *auditStorage) ClearFraudFlag(_ context.Context, _ string, rec models.AuditRecord) error {
+	return s.audit(rec)
+}
+
+func (s *auditStorage) AdminRevokeAPIKey(_ context.Context, _ string, _ string, rec models.AuditRecord) error {
+	return s.audit(rec)
+}
+
+func (s *auditStorage) RepollOrder(_ context.Context, _ string, rec models.AuditRecord) error {
+	return s.audit(rec)
+}
+
+func (s *auditStorage) InvalidateOrder(_ context.Context, _ string, rec models.AuditRecord) error {
+	return s.audit(rec)
+}
+
+func (s *auditStorage) ApproveWithdrawal(_ context.Context, _ string, rec models.AuditRecord) (models.Hold, error) {
+	return models.Hold{}, s.audit(rec)
+}
+
+func (s *auditStorage) RejectWithdrawal(_ context.Context, _ string, rec models.AuditRecord) (models.Hold, error) {
+	return models.Hold{}, s.audit(rec)
+}
+
+func (s *auditStorage) InsertCampaign(_ context.Context, c models.Campaign,
+	rec models.AuditRecord) (models.Campaign, error) {
+	return c, s.audit(rec)
+}
+
+func (s *auditStorage) EndCampaign(_ context.Context, _ string, rec models.AuditRecord) error {
+	return s.audit(rec)
+}
+
+func (s *auditStorage) SearchUsers(context.Context, string, int) ([]models.UserInfo, error) {
+	return nil, nil
+}
+
+func TestAdminActionsAreAudited(t *testing.T) {
+	const reason = `{"reason":"support ticket"}`
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantAction string
+		wantTarget string
+		wantCode   int
+	}{
+		{name: "block", path: "/api/admin/users/bob/block", wantCode: http.StatusOK,
+			wantAction: auditBlockUser, wantTarget: "bob"},
+		{name: "unblock", path: "/api/admin/users/bob/unblock", wantCode: http.StatusOK,
+			wantAction: auditUnblockUser, wantTarget: "bob"},
+		{name: "clear fraud flag", path: "/api/admin/users/bob/unflag", wantCode: http.StatusOK,
+			wantAction: auditClearFraudFlag, wantTarget: "bob"},
+		{name: "revoke api key", method: http.MethodDelete, path: "/api/admin/users/bob/api-keys/k1",
+			wantCode: http.StatusNoContent, wantAction: auditRevokeAPIKey, wantTarget: "bob/k1"},
+		{name: "re-poll order", path: "/api/admin/orders/79927398713/repoll", wantCode: http.StatusAccepted,
+			wantAction: auditRepollOrder, wantTarget: "79927398713"},
+		{name: "mark order invalid", path: "/api/admin/orders/79927398713/invalidate", wantCode: http.StatusOK,
+			wantAction: auditInvalidateOrder, wantTarget: "79927398713"},
+		{name: "approve withdrawal", path: "/api/admin/withdrawals/h1/approve", wantCode: http.StatusOK,
+			wantAction: auditApproveWithdrawal, wantTarget: "h1"},
+		{name: "reject withdrawal", path: "/api/admin/withdrawals/h1/reject", wantCode: http.StatusOK,
+			wantAction: auditRejectWithdrawal, wantTarget: "h1"},
+		{name: "create campaign", path: "/api/admin/campaigns", wantCode: http.StatusCreated,
+			body: `{"name":"Double","starts_at":"2024-06-01T00:00:00Z","ends_at":"2024-06-02T00:00:00Z",` +
+				`"multiplier":2,"reason":"support ticket"}`,
+			wantAction: auditCreateCampaign},
+		{name: "end campaign", path: "/api/admin/campaigns/c1/end", wantCode: http.StatusOK,
+			wantAction: auditEndCampaign, wantTarget: "c1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, body := tt.method, tt.body
+			if method == "" {
+				method = http.MethodPost
+			}
+			if body == "" {
+				body = reason
+			}
+			s := &auditStorage{}
+			r := newTestRouter(t, s)
+
+			req := httptest.NewRequest(method, tt.path, strings.NewReader(body))
+			req.Header.Set(contentType, applicationJSON)
+			req.Header.Set(authorization, testToken(t, "bob", role.User))
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusForbidden, rec.Code, "a non-admin must be refused")
+			assert.Empty(t, s.records)
+
+			req = httptest.NewRequest(method, tt.path, strings.NewReader(body))
+			req.Header.Set(contentType, applicationJSON)
+			req.Header.Set(authorization, testToken(t, "root", role.Admin))
+			rec = httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Equal(t, []models.AuditRecord{{
+				Admin:  "root",
+				Action: tt.wantAction,
+				Target: tt.wantTarget,
+				Reason: "support ticket",
+			}}, s.records)
+
+			s.records = nil
+			req = httptest.NewRequest(method, tt.path, strings.NewReader(`{}`))
+			req.Header.Set(contentType, applicationJSON)
+			req.Header.Set(authorization, testToken(t, "root", role.Admin))
+			rec = httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, "an action without a reason must be refused")
+			assert.Empty(t, s.records)
+		})
+	}
+}
+
+// reversedOrderStorage answers order actions as if the order were reversed.
+type reversedOrderStorage struct {
+	auditStorage
+}
+
+func (s *reversedOrderStorage) RepollOrder(context.Context, string, models.AuditRecord) error {
+	return models.ErrOrderReversed
+}
+
+func (s *reversedOrderStorage) InvalidateOrder(context.Context, string, models.AuditRecord) error {
+	return models.ErrOrderReversed
+}
+
+func TestAdminOrderActionsOnReversedOrder(t *testing.T) {
+	r := newTestRouter(t, &reversedOrderStorage{})
+	for _, action := range []string{"repoll", "invalidate"} {
+		t.Run(action, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/orders/79927398713/"+action,
+				strings.NewReader(`{"reason":"support ticket"}`))
+			req.Header.Set(contentType, applicationJSON)
+			req.Header.Set(authorization, testToken(t, "root", role.Admin))
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusConflict, rec.Code)
+		})
+	}
+}
+
+func TestAdminReadsNeedAdmin(t *testing.T) {
+	r := newTestRouter(t, &auditStorage{})
+	tests := []struct {
+		name     string
+		role     role.Role
+		wantCode int
+	}{
+		{name: "user", role: role.User, wantCode: http.StatusForbidden},
+		{name: "admin", role: role.Admin, wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/users?q=_", http.NoBody)
+			req.Header.Set(authorization, testToken(t, "someone", tt.role))
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantCode, rec.Code)
+		})
+	}
+}
@@ -3,75 +3,184 @@ package v1
 import (
 	"context"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/ospiem/gophermart/internal/config"
+	"github.com/ospiem/gophermart/internal/hasher"
+	"github.com/ospiem/gophermart/internal/health"
+	"github.com/ospiem/gophermart/internal/metrics"
 	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/fraud"
+	"github.com/ospiem/gophermart/internal/models/role"
+	"github.com/ospiem/gophermart/internal/models/scope"
+	"github.com/ospiem/gophermart/internal/notifier"
 	"github.com/ospiem/gophermart/internal/tools"
+	"github.com/ospiem/gophermart/internal/tracing"
 	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/auth"
+	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/idempotency"
 	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/logger"
+	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/requestid"
 	"github.com/rs/zerolog"
 )
 
-type storage interface {
-	InsertOrder(ctx context.Context, order models.Order, logger zerolog.Logger) error
+// Storage is what the API needs from the storage.
+type Storage interface {
+	InsertOrder(ctx context.Context, order models.Order) error
 	SelectOrder(ctx context.Context, num string) (models.Order, error)
 	SelectOrders(ctx context.Context, login string) ([]models.OrderResponse, error)
 	SelectCreds(ctx context.Context, login string) (models.Credentials, error)
 	SelectUserBalance(ctx context.Context, login string) (models.UserBalance, error)
-	InsertUser(ctx context.Context, login string, hash string, l zerolog.Logger) error
-	InsertWithdraw(ctx context.Context, withdraw models.Withdraw, l zerolog.Logger) error
+	InsertUser(ctx context.Context, login string, hash string, referral string) error
+	InsertWithdraw(ctx context.Context, withdraw models.Withdraw) error
 	SelectWithdraws(ctx context.Context, login string) ([]models.WithdrawResponse, error)
+	SelectTokenVersion(ctx context.Context, login string) (int, error)
+	UpdatePassword(ctx context.Context, login string, hash string) (models.Credentials, error)
+	InsertResetToken(ctx context.Context, login string, tokenHash string, ttl time.Duration) error
+	ResetPassword(ctx context.Context, tokenHash string, hash string) (models.Credentials, error)
+	SelectAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error)
+	TouchAPIKey(ctx context.Context, id string) error
+	InsertAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error)
+	SelectAPIKeys(ctx context.Context, login string) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, login string, id string) error
+	SearchUsers(ctx context.Context, query string, limit int) ([]models.UserInfo, error)
+	SelectUserInfo(ctx context.Context, login string) (models.UserInfo, error)
+	SetUserBlocked(ctx context.Context, login string, blocked bool, rec models.AuditRecord) error
+	RepollOrder(ctx context.Context, id string, rec models.AuditRecord) error
+	InvalidateOrder(ctx context.Context, id string, rec models.AuditRecord) error
+	AdminRevokeAPIKey(ctx context.Context, login string, id string, rec models.AuditRecord) error
+	SelectAuditRecords(ctx context.Context, limit int) ([]models.AuditRecord, error)
+	AdjustBalance(ctx context.Context, adj models.Adjustment) (models.Adjustment, error)
+	SelectAdjustments(ctx context.Context, login string) ([]models.Adjustment, error)
+	SelectBalanceHistory(ctx context.Context, login string) ([]models.HistoryEntry, error)
+	ReverseOrder(ctx context.Context, rev models.Reversal) (models.Reversal, error)
+	SelectExpiringPoints(ctx context.Context, login string, within time.Duration) (float32, error)
+	CreateHold(ctx context.Context, h models.Hold) (models.Hold, error)
+	ConfirmHold(ctx context.Context, login string, id string) (models.Hold, error)
+	CancelHold(ctx context.Context, login string, id string) (models.Hold, error)
+	SelectHolds(ctx context.Context, login string) ([]models.Hold, error)
+	ReserveIdempotencyKey(ctx context.Context, res models.IdempotentResponse) (models.IdempotentResponse, bool, error)
+	SaveIdempotentResponse(ctx context.Context, res models.IdempotentResponse) error
+	DeleteIdempotencyKey(ctx context.Context, login string, key string) error
+	Transfer(ctx context.Context, t models.Transfer, dailyLimit float32) (models.Transfer, error)
+	SelectReferrals(ctx context.Context, login string) (models.Referrals, error)
+	InsertCampaign(ctx context.Context, c models.Campaign, rec models.AuditRecord) (models.Campaign, error)
+	SelectCampaigns(ctx context.Context) ([]models.Campaign, error)
+	EndCampaign(ctx context.Context, id string, rec models.AuditRecord) error
+	SelectTierStatus(ctx context.Context, login string) (models.TierStatus, error)
+	RecordSignal(ctx context.Context, login string, signal fraud.Signal, orderID string) (bool, error)
+	IsFlagged(ctx context.Context, login string) (bool, error)
+	SelectFraudFlags(ctx context.Context, limit int) ([]models.FraudFlag, error)
+	ClearFraudFlag(ctx context.Context, login string, rec models.AuditRecord) error
+	SelectPendingWithdrawals(ctx context.Context, limit int) ([]models.PendingWithdrawal, error)
+	ApproveWithdrawal(ctx context.Context, id string, rec models.AuditRecord) (models.Hold, error)
+	RejectWithdrawal(ctx context.Context, id string, rec models.AuditRecord) (models.Hold, error)
 }
 
 type API struct {
-	storage storage
-	log     zerolog.Logger
-	cfg     config.Config
+	storage  Storage
+	hasher   *hasher.Pool
+	notifier notifier.Notifier
+	metrics  *metrics.Metrics
+	health   *health.Checker
+	log      zerolog.Logger
+	cfg      atomic.Pointer[config.Config]
 }
 
-func New(cfg *config.Config, s storage, l *zerolog.Logger) *API {
+func New(cfg *config.Config, s Storage, m *metrics.Metrics, h *health.Checker, l *zerolog.Logger) *API {
 	tools.SetGlobalLogLevel(cfg.LogLevel)
-	return &API{
-		cfg:     *cfg,
-		storage: s,
-		log:     *l,
+	a := &API{
+		storage:  s,
+		hasher:   hasher.New(cfg.HashWorkers, cfg.HashQueueSize),
+		notifier: notifier.New(cfg.ResetNotifier, cfg.ResetNotifierFile, *l),
+		metrics:  m,
+		health:   h,
+		log:      *l,
 	}
+	a.Reload(*cfg)
+	return a
 }
 
-func (a *API) registerAPI() chi.Router {
+// config returns the settings in effect. Handlers must not keep the result
+// past the request, since Reload may replace it.
+func (a *API) config() *config.Config {
+	return a.cfg.Load()
+}
+
+// Reload swaps in new settings for the requests that follow. The caller is
+// responsible for passing only changes that are safe to apply live.
+func (a *API) Reload(cfg config.Config) {
+	a.cfg.Store(&cfg)
+}
+
+// Router builds the API routes. The middlewares run after the built-in ones,
+// so they see the request ID and the request logger.
+func (a *API) Router(middlewares ...func(http.Handler) http.Handler) chi.Router {
 	r := chi.NewRouter()
 
 	r.Use(middleware.Recoverer)
+	r.Use(a.metrics.Middleware)
+	r.Use(tracing.Middleware)
+	r.Use(requestid.Middleware)
 	r.Use(logger.RequestLogger(a.log))
+	r.Use(middlewares...)
+
+	if a.health != nil {
+		r.Get("/healthz", a.health.Live)
+		r.Get("/readyz", a.health.Ready)
+	}
 
 	r.Route("/api/user", func(r chi.Router) {
 		r.Post("/register", a.registerUser)
 		r.Post("/login", a.authUser)
+		r.Post("/password/reset", a.requestPasswordReset)
+		r.Post("/password/reset/confirm", a.confirmPasswordReset)
 
 		r.Group(func(r chi.Router) {
-			r.Use(auth.JWTAuthorization(a.cfg.JWTSecretKey))
-			r.Post("/orders", a.postOrder)
-			r.Get("/orders", a.getOrders)
-			r.Get("/withdrawals", a.getWithdrawals)
+			r.Use(auth.JWTAuthorization(a.config().JWTSecretKey, a.storage))
+			idempotent := idempotency.Middleware(a.storage, a.config().IdempotencyTTL)
+			r.With(auth.RequireScope(scope.OrdersWrite), idempotent).Post("/orders", a.postOrder)
+			r.With(auth.RequireScope(scope.OrdersRead)).Get("/orders", a.getOrders)
+			r.With(auth.RequireScope(scope.OrdersReverse)).Post("/orders/{id}/reverse", a.reverseOrder)
+			r.With(auth.RequireScope(scope.WithdrawalsRead)).Get("/withdrawals", a.getWithdrawals)
 
 			r.Route("/balance", func(r chi.Router) {
-				r.Get("/", a.getBalance)
-				r.Post("/withdraw", a.orderWithdraw)
+				r.With(auth.RequireScope(scope.BalanceRead)).Get("/", a.getBalance)
+				r.With(auth.RequireScope(scope.BalanceRead)).Get("/history", a.getBalanceHistory)
+				r.With(auth.RequireScope(scope.BalanceRead)).Get("/tier", a.getTier)
+				r.With(auth.RequireScope(scope.BalanceWithdraw), idempotent).Post("/withdraw", a.orderWithdraw)
+				r.With(auth.RequireScope(scope.BalanceWithdraw), idempotent).Post("/transfer", a.transferPoints)
+
+				r.Route("/holds", func(r chi.Router) {
+					r.With(auth.RequireScope(scope.BalanceRead)).Get("/", a.getHolds)
+					r.Group(func(r chi.Router) {
+						r.Use(auth.RequireScope(scope.BalanceWithdraw))
+						r.Post("/", a.createHold)
+						r.Post("/{id}/confirm", a.confirmHold)
+						r.Post("/{id}/cancel", a.cancelHold)
+					})
+				})
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(auth.RequireScope(scope.Session))
+				r.Post("/password", a.changePassword)
+				r.Post("/api-keys", a.createAPIKey)
+				r.Get("/api-keys", a.getAPIKeys)
+				r.Delete("/api-keys/{id}", a.revokeAPIKey)
+				r.Get("/referrals", a.getReferrals)
 			})
 		})
 	})
 
-	return r
-}
-
-func (a *API) InitServer() *http.Server {
-	a.log.Info().Msgf("Starting server on %s", a.cfg.Endpoint)
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(auth.JWTAuthorization(a.config().JWTSecretKey, a.storage))
+		r.Use(auth.RequireScope(scope.Session))
+		r.Use(auth.RequireRole(role.Admin))
+		a.registerAdminAPI(r)
+	})
 
-	r := a.registerAPI()
-	return &http.Server{
-		Addr:    a.cfg.Endpoint,
-		Handler: r,
-	}
+	return r
 }
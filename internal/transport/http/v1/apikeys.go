@@ -0,0 +1,121 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/apikey"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/scope"
+	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/auth"
+	"github.com/rs/zerolog"
+)
+
+func (a *API) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "createAPIKey").Logger()
+
+	if r.Header.Get(contentType) != applicationJSON {
+		http.Error(w, invalitContentTypeNotJSON, http.StatusBadRequest)
+		logger.Debug().Msg(invalidContentType)
+		return
+	}
+
+	ctx := r.Context()
+	login, ok := ctx.Value(auth.ContextLoginKey).(string)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	req := models.APIKeyRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, invalidBody, http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" || len(req.Scopes) == 0 {
+		http.Error(w, invalidBody, http.StatusBadRequest)
+		return
+	}
+	for _, s := range req.Scopes {
+		if !scope.IsGrantable(s) {
+			http.Error(w, "Unknown scope "+s, http.StatusBadRequest)
+			return
+		}
+	}
+
+	key, prefix, err := apikey.Generate()
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot generate api key")
+		return
+	}
+
+	k, err := a.storage.InsertAPIKey(ctx, models.APIKey{
+		Username: login,
+		Name:     req.Name,
+		Prefix:   prefix,
+		Hash:     apikey.Hash(key),
+		Scopes:   req.Scopes,
+	})
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot insert api key")
+		return
+	}
+	// The key itself is shown only once, in this response.
+	k.Key = key
+
+	w.Header().Set(contentType, applicationJSON)
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(k); err != nil {
+		logger.Error().Err(err).Msg("cannot encode api key")
+	}
+}
+
+func (a *API) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "getAPIKeys").Logger()
+	ctx := r.Context()
+	w.Header().Set(contentType, applicationJSON)
+
+	login, ok := ctx.Value(auth.ContextLoginKey).(string)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+	keys, err := a.storage.SelectAPIKeys(ctx, login)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot get api keys")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(keys); err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot encode api keys")
+	}
+}
+
+func (a *API) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "revokeAPIKey").Logger()
+	ctx := r.Context()
+
+	login, ok := ctx.Value(auth.ContextLoginKey).(string)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	if err := a.storage.RevokeAPIKey(ctx, login, chi.URLParam(r, "id")); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot revoke api key")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
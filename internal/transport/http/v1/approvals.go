@@ -0,0 +1,110 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/hold"
+	"github.com/ospiem/gophermart/internal/models/limit"
+	"github.com/rs/zerolog"
+)
+
+const (
+	auditApproveWithdrawal = "approve_withdrawal"
+	auditRejectWithdrawal  = "reject_withdrawal"
+)
+
+type limitResponse struct {
+	*limit.Violation
+	Message string `json:"error"`
+}
+
+// needsApproval tells whether a withdrawal of sum must wait for an admin.
+func (a *API) needsApproval(sum float32) bool {
+	threshold := a.config().ApprovalThreshold
+	return threshold > 0 && float64(sum) >= threshold
+}
+
+// pendingHold returns the hold that keeps a withdrawal of sum waiting for approval.
+func (a *API) pendingHold(login string, orderNumber string, sum float32) models.Hold {
+	return models.Hold{
+		Username:    login,
+		OrderNumber: orderNumber,
+		Sum:         sum,
+		Status:      hold.PENDING,
+		TTL:         a.config().ApprovalTTL,
+	}
+}
+
+// writeLimitViolation responds with the limit that err reports, if any, and
+// tells whether it did.
+func writeLimitViolation(w http.ResponseWriter, err error, logger zerolog.Logger) bool {
+	var v *limit.Violation
+	if !errors.As(err, &v) {
+		return false
+	}
+	code := http.StatusTooManyRequests
+	if v.Limit == limit.PerTransaction || v.Limit == limit.MinBalance {
+		code = http.StatusUnprocessableEntity
+	}
+	w.Header().Set(contentType, applicationJSON)
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(limitResponse{Violation: v, Message: v.Error()}); err != nil {
+		logger.Error().Err(err).Msg("cannot encode limit violation")
+	}
+	return true
+}
+
+func (a *API) adminGetPendingWithdrawals(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminGetPendingWithdrawals").Logger()
+
+	pending, err := a.storage.SelectPendingWithdrawals(r.Context(), adminLimit(r))
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot get pending withdrawals")
+		return
+	}
+	encodeJSON(w, pending, logger)
+}
+
+func (a *API) adminApproveWithdrawal(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminApproveWithdrawal").Logger()
+	a.resolvePendingWithdrawal(w, r, logger, auditApproveWithdrawal, a.storage.ApproveWithdrawal)
+}
+
+func (a *API) adminRejectWithdrawal(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminRejectWithdrawal").Logger()
+	a.resolvePendingWithdrawal(w, r, logger, auditRejectWithdrawal, a.storage.RejectWithdrawal)
+}
+
+func (a *API) resolvePendingWithdrawal(w http.ResponseWriter, r *http.Request, logger zerolog.Logger,
+	action string, resolve func(ctx context.Context, id string, rec models.AuditRecord) (models.Hold, error)) {
+	id := chi.URLParam(r, "id")
+	rec, ok := a.auditRecord(w, r, action, id)
+	if !ok {
+		return
+	}
+	h, err := resolve(r.Context(), id, rec)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Pending withdrawal not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, models.ErrOrderInUse) {
+			http.Error(w, orderNumberInUse, http.StatusConflict)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot resolve pending withdrawal")
+		return
+	}
+	if h.Status == hold.CONFIRMED {
+		a.metrics.PointsWithdrawn(h.Sum)
+	}
+	encodeJSON(w, h, logger)
+}
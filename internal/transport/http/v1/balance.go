@@ -0,0 +1,116 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/reason"
+	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/auth"
+	"github.com/rs/zerolog"
+)
+
+func (a *API) getBalanceHistory(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "getBalanceHistory").Logger()
+	ctx := r.Context()
+
+	login, ok := ctx.Value(auth.ContextLoginKey).(string)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+	entries, err := a.storage.SelectBalanceHistory(ctx, login)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot get balance history")
+		return
+	}
+	encodeJSON(w, entries, logger)
+}
+
+func (a *API) getTier(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "getTier").Logger()
+	ctx := r.Context()
+
+	login, ok := ctx.Value(auth.ContextLoginKey).(string)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+	ts, err := a.storage.SelectTierStatus(ctx, login)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot get tier")
+		return
+	}
+	encodeJSON(w, ts, logger)
+}
+
+func (a *API) adminAdjustBalance(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminAdjustBalance").Logger()
+
+	if r.Header.Get(contentType) != applicationJSON {
+		http.Error(w, invalitContentTypeNotJSON, http.StatusBadRequest)
+		logger.Debug().Msg(invalidContentType)
+		return
+	}
+
+	ctx := r.Context()
+	admin, ok := ctx.Value(auth.ContextLoginKey).(string)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	req := models.AdjustmentRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, invalidBody, http.StatusBadRequest)
+		return
+	}
+	if req.Amount == 0 || req.Comment == "" || !reason.IsValid(req.ReasonCode) {
+		http.Error(w, "Amount, comment and a valid reason code are required", http.StatusBadRequest)
+		return
+	}
+
+	adj, err := a.storage.AdjustBalance(ctx, models.Adjustment{
+		Username:   chi.URLParam(r, "login"),
+		Amount:     req.Amount,
+		ReasonCode: req.ReasonCode,
+		Comment:    req.Comment,
+		Admin:      admin,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, userNotFound, http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, models.ErrInsufficientBalance) {
+			http.Error(w, "Balance cannot become negative", http.StatusConflict)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot adjust balance")
+		return
+	}
+
+	w.Header().Set(contentType, applicationJSON)
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(adj); err != nil {
+		logger.Error().Err(err).Msg("cannot encode adjustment")
+	}
+}
+
+func (a *API) adminGetAdjustments(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminGetAdjustments").Logger()
+
+	adjustments, err := a.storage.SelectAdjustments(r.Context(), chi.URLParam(r, "login"))
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot get adjustments")
+		return
+	}
+	encodeJSON(w, adjustments, logger)
+}
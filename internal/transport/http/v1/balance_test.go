@@ -0,0 +1,75 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/role"
+	"github.com/stretchr/testify/assert"
+)
+
+type adjustStorage struct {
+	Storage
+	err      error
+	adjusted []models.Adjustment
+}
+
+func (s *adjustStorage) SelectTokenVersion(context.Context, string) (int, error) {
+	return 0, nil
+}
+
+func (s *adjustStorage) AdjustBalance(_ context.Context, adj models.Adjustment) (models.Adjustment, error) {
+	if s.err != nil {
+		return models.Adjustment{}, s.err
+	}
+	s.adjusted = append(s.adjusted, adj)
+	return adj, nil
+}
+
+func TestAdminAdjustBalance(t *testing.T) {
+	tests := []struct {
+		err          error
+		name         string
+		body         string
+		wantCode     int
+		wantAdjusted bool
+	}{
+		{name: "credit", body: `{"amount":10,"reason_code":"GOODWILL","comment":"sorry"}`,
+			wantCode: http.StatusCreated, wantAdjusted: true},
+		{name: "missing reason code", body: `{"amount":10,"comment":"sorry"}`, wantCode: http.StatusBadRequest},
+		{name: "unknown reason code", body: `{"amount":10,"reason_code":"BECAUSE","comment":"sorry"}`,
+			wantCode: http.StatusBadRequest},
+		{name: "missing comment", body: `{"amount":10,"reason_code":"GOODWILL"}`, wantCode: http.StatusBadRequest},
+		{name: "zero amount", body: `{"reason_code":"GOODWILL","comment":"sorry"}`, wantCode: http.StatusBadRequest},
+		{name: "debit below zero", body: `{"amount":-10,"reason_code":"CORRECTION","comment":"oops"}`,
+			err: models.ErrInsufficientBalance, wantCode: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &adjustStorage{err: tt.err}
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/users/bob/adjustments",
+				strings.NewReader(tt.body))
+			req.Header.Set(contentType, applicationJSON)
+			req.Header.Set(authorization, testToken(t, "root", role.Admin))
+			rec := httptest.NewRecorder()
+			newTestRouter(t, s).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			if !tt.wantAdjusted {
+				assert.Empty(t, s.adjusted)
+				return
+			}
+			assert.Equal(t, []models.Adjustment{{
+				Username:   "bob",
+				Amount:     10,
+				ReasonCode: "GOODWILL",
+				Comment:    "sorry",
+				Admin:      "root",
+			}}, s.adjusted)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/campaign"
+	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/auth"
+	"github.com/rs/zerolog"
+)
+
+const (
+	auditCreateCampaign = "create_campaign"
+	auditEndCampaign    = "end_campaign"
+)
+
+func (a *API) adminGetCampaigns(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminGetCampaigns").Logger()
+
+	campaigns, err := a.storage.SelectCampaigns(r.Context())
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot get campaigns")
+		return
+	}
+	encodeJSON(w, campaigns, logger)
+}
+
+func (a *API) adminCreateCampaign(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminCreateCampaign").Logger()
+
+	if r.Header.Get(contentType) != applicationJSON {
+		http.Error(w, invalitContentTypeNotJSON, http.StatusBadRequest)
+		logger.Debug().Msg(invalidContentType)
+		return
+	}
+	ctx := r.Context()
+	admin, ok := ctx.Value(auth.ContextLoginKey).(string)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	req := models.CampaignRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, invalidBody, http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "" {
+		http.Error(w, "Reason is required", http.StatusBadRequest)
+		return
+	}
+	if err := campaign.Validate(req.Campaign); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	req.CreatedBy = admin
+
+	c, err := a.storage.InsertCampaign(ctx, req.Campaign, models.AuditRecord{
+		Admin:  admin,
+		Action: auditCreateCampaign,
+		Reason: req.Reason,
+	})
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot create campaign")
+		return
+	}
+	w.Header().Set(contentType, applicationJSON)
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(c); err != nil {
+		logger.Error().Err(err).Msg("cannot encode campaign")
+	}
+}
+
+func (a *API) adminEndCampaign(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminEndCampaign").Logger()
+
+	id := chi.URLParam(r, "id")
+	rec, ok := a.auditRecord(w, r, auditEndCampaign, id)
+	if !ok {
+		return
+	}
+	if err := a.storage.EndCampaign(r.Context(), id, rec); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Running or upcoming campaign not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot end campaign")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
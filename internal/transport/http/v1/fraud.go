@@ -0,0 +1,60 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models/fraud"
+	"github.com/rs/zerolog"
+)
+
+const auditClearFraudFlag = "clear_fraud_flag"
+const uploadsSuspended = "Order uploads are suspended, contact support"
+
+// recordSignal stores a suspicious upload. Failing to store it must not fail the upload.
+func (a *API) recordSignal(ctx context.Context, logger zerolog.Logger, login string, signal fraud.Signal,
+	orderID string) {
+	flagged, err := a.storage.RecordSignal(ctx, login, signal, orderID)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot record upload signal")
+		return
+	}
+	if flagged {
+		logger.Warn().Str("login", login).Str("signal", signal).Msg("user is flagged as suspicious")
+	}
+}
+
+func (a *API) adminGetFraudFlags(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminGetFraudFlags").Logger()
+
+	flags, err := a.storage.SelectFraudFlags(r.Context(), adminLimit(r))
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot get fraud flags")
+		return
+	}
+	encodeJSON(w, flags, logger)
+}
+
+func (a *API) adminClearFraudFlag(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "adminClearFraudFlag").Logger()
+
+	login := chi.URLParam(r, "login")
+	rec, ok := a.auditRecord(w, r, auditClearFraudFlag, login)
+	if !ok {
+		return
+	}
+	if err := a.storage.ClearFraudFlag(r.Context(), login, rec); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User is not flagged", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot clear fraud flag")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
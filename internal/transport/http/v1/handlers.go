@@ -13,10 +13,14 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/hasher"
 	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/fraud"
+	"github.com/ospiem/gophermart/internal/models/role"
+	"github.com/ospiem/gophermart/internal/models/scope"
 	"github.com/ospiem/gophermart/internal/models/status"
 	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/auth"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/rs/zerolog"
 )
 
 const handler = "handler"
@@ -30,13 +34,14 @@ const invalidBody = "Invalid body"
 const tokenExp = time.Hour * 2
 const invalitContentTypeNotJSON = "Invalid Content-Type, expected application/json"
 const evenDivisor = 2
+const serviceBusy = "Service is busy, try again later"
 
 var ErrOrderBelongsAnotherUser = errors.New("the order belongs to another user")
 var ErrOrderExists = errors.New("order exists")
 var ErrInsufficientPoints = errors.New("insufficient points ")
 
 func (a *API) registerUser(w http.ResponseWriter, r *http.Request) {
-	logger := a.log.With().Str(handler, "registerUser").Logger()
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "registerUser").Logger()
 
 	if r.Header.Get(contentType) != applicationJSON {
 		http.Error(w, invalitContentTypeNotJSON, http.StatusBadRequest)
@@ -56,14 +61,22 @@ func (a *API) registerUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hash, err := hashPass(credentials.Pass)
+	hash, err := a.hasher.Hash(ctx, credentials.Pass)
 	if err != nil {
+		if errors.Is(err, hasher.ErrQueueFull) {
+			http.Error(w, serviceBusy, http.StatusServiceUnavailable)
+			return
+		}
 		http.Error(w, "", http.StatusInternalServerError)
 		logger.Error().Err(err).Msg(cannotGetUser)
 		return
 	}
 
-	if err := a.storage.InsertUser(ctx, credentials.Login, hash, a.log); err != nil {
+	if err := a.storage.InsertUser(ctx, credentials.Login, hash, credentials.Referral); err != nil {
+		if errors.Is(err, models.ErrUnknownReferral) || errors.Is(err, models.ErrReferralLoop) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
 		if !errors.Is(err, pgx.ErrNoRows) {
 			http.Error(w, "That username is taken. Try another", http.StatusConflict)
 			return
@@ -73,7 +86,7 @@ func (a *API) registerUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := buildJWTString(credentials.Login, a.cfg.JWTSecretKey)
+	token, err := buildJWTString(models.Credentials{Login: credentials.Login, Role: role.User}, a.config().JWTSecretKey)
 	if err != nil {
 		http.Error(w, "", http.StatusInternalServerError)
 		logger.Error().Err(err).Msg("cannot build token string")
@@ -85,7 +98,7 @@ func (a *API) registerUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *API) authUser(w http.ResponseWriter, r *http.Request) {
-	logger := a.log.With().Str(handler, "authUser").Logger()
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "authUser").Logger()
 
 	if r.Header.Get(contentType) != applicationJSON {
 		http.Error(w, invalitContentTypeNotJSON, http.StatusBadRequest)
@@ -111,12 +124,23 @@ func (a *API) authUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := compareHash(dbCreds.Pass, loginCreds.Pass); err != nil {
+	if err := a.hasher.Compare(ctx, dbCreds.Pass, loginCreds.Pass); err != nil {
+		if errors.Is(err, hasher.ErrQueueFull) {
+			http.Error(w, serviceBusy, http.StatusServiceUnavailable)
+			return
+		}
+		if !errors.Is(err, hasher.ErrMismatch) {
+			logger.Error().Err(err).Msg("cannot compare password hash")
+		}
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if dbCreds.Blocked {
+		http.Error(w, "Account is blocked", http.StatusForbidden)
+		return
+	}
 
-	token, err := buildJWTString(loginCreds.Login, a.cfg.JWTSecretKey)
+	token, err := buildJWTString(dbCreds, a.config().JWTSecretKey)
 	if err != nil {
 		http.Error(w, "", http.StatusInternalServerError)
 		logger.Error().Err(err).Msg("cannot build token string")
@@ -128,7 +152,7 @@ func (a *API) authUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *API) postOrder(w http.ResponseWriter, r *http.Request) {
-	logger := a.log.With().Str(handler, "postOrder").Logger()
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "postOrder").Logger()
 
 	if r.Header.Get(contentType) != "text/plain" {
 		http.Error(w, "Invalid Content-Type, expected text/plain", http.StatusBadRequest)
@@ -141,19 +165,33 @@ func (a *API) postOrder(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		http.Error(w, "", http.StatusBadRequest)
 		logger.Error().Err(err).Msg("cannot read body")
-	}
-	orderID := string(body)
-	if err = validByLuhnAlgo(orderID); err != nil {
-		http.Error(w, "Invalid order number", http.StatusUnprocessableEntity)
-		logger.Debug().Err(err).Msg("")
 		return
 	}
+	orderID := string(body)
 
 	login, ok := r.Context().Value(auth.ContextLoginKey).(string)
 	if !ok {
 		http.Error(w, "", http.StatusUnauthorized)
 		return
 	}
+	flagged, err := a.storage.IsFlagged(ctx, login)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot check fraud flag")
+		return
+	}
+	if flagged {
+		http.Error(w, uploadsSuspended, http.StatusTooManyRequests)
+		return
+	}
+
+	if err = validByLuhnAlgo(orderID); err != nil {
+		http.Error(w, "Invalid order number", http.StatusUnprocessableEntity)
+		logger.Debug().Err(err).Msg("")
+		a.recordSignal(ctx, logger, login, fraud.InvalidNumber, "")
+		return
+	}
+
 	order := models.Order{
 		ID:       orderID,
 		Status:   status.NEW,
@@ -168,6 +206,7 @@ func (a *API) postOrder(w http.ResponseWriter, r *http.Request) {
 		}
 		if errors.Is(err, ErrOrderBelongsAnotherUser) {
 			w.WriteHeader(http.StatusConflict)
+			a.recordSignal(ctx, logger, login, fraud.Conflict, order.ID)
 			return
 		}
 		w.WriteHeader(http.StatusInternalServerError)
@@ -175,7 +214,7 @@ func (a *API) postOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = a.storage.InsertOrder(ctx, order, a.log); err != nil {
+	if err = a.storage.InsertOrder(ctx, order); err != nil {
 		http.Error(w, "", http.StatusInternalServerError)
 		logger.Error().Err(err).Msg("cannot insert order to DB")
 		return
@@ -185,7 +224,7 @@ func (a *API) postOrder(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *API) getOrders(w http.ResponseWriter, r *http.Request) {
-	logger := a.log.With().Str(handler, "getOrders").Logger()
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "getOrders").Logger()
 	ctx := r.Context()
 	w.Header().Set(contentType, applicationJSON)
 
@@ -217,7 +256,7 @@ func (a *API) getOrders(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *API) orderWithdraw(w http.ResponseWriter, r *http.Request) {
-	logger := a.log.With().Str(handler, "orderWithdraw").Logger()
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "orderWithdraw").Logger()
 	if r.Header.Get(contentType) != applicationJSON {
 		http.Error(w, invalitContentTypeNotJSON, http.StatusBadRequest)
 		logger.Debug().Msg(invalidContentType)
@@ -247,6 +286,11 @@ func (a *API) orderWithdraw(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if a.needsApproval(withdraw.Sum) {
+		a.placeHold(w, r, logger, a.pendingHold(login, withdraw.OrderNumber, withdraw.Sum), http.StatusAccepted)
+		return
+	}
+
 	if err := proceedWithdraw(ctx, a, withdraw); err != nil {
 		if errors.Is(err, ErrInsufficientPoints) {
 			http.Error(w, "Insufficient points", http.StatusPaymentRequired)
@@ -256,14 +300,22 @@ func (a *API) orderWithdraw(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Insufficient points", http.StatusUnprocessableEntity)
 			return
 		}
+		if errors.Is(err, models.ErrWithdrawalsBlocked) {
+			http.Error(w, "Withdrawals are blocked until reversed points are repaid", http.StatusForbidden)
+			return
+		}
+		if writeLimitViolation(w, err, logger) {
+			return
+		}
 		http.Error(w, "", http.StatusInternalServerError)
 		logger.Error().Err(err).Msg("cannot proceed withdraw")
+		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
 func (a *API) getWithdrawals(w http.ResponseWriter, r *http.Request) {
-	logger := a.log.With().Str(handler, "getWithdrawals").Logger()
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "getWithdrawals").Logger()
 	ctx := r.Context()
 	w.Header().Set(contentType, applicationJSON)
 
@@ -287,7 +339,7 @@ func (a *API) getWithdrawals(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *API) getBalance(w http.ResponseWriter, r *http.Request) {
-	logger := a.log.With().Str(handler, "getBalance").Logger()
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "getBalance").Logger()
 	ctx := r.Context()
 	w.Header().Set(contentType, applicationJSON)
 	login, ok := r.Context().Value(auth.ContextLoginKey).(string)
@@ -302,6 +354,14 @@ func (a *API) getBalance(w http.ResponseWriter, r *http.Request) {
 		logger.Error().Err(err).Msg("cannot get balance")
 		return
 	}
+	if a.config().PointsExpiry > 0 {
+		user.ExpiringSoon, err = a.storage.SelectExpiringPoints(ctx, login, a.config().ExpiringSoonWindow)
+		if err != nil {
+			http.Error(w, "", http.StatusInternalServerError)
+			logger.Error().Err(err).Msg("cannot get expiring points")
+			return
+		}
+	}
 	enc := json.NewEncoder(w)
 	if err := enc.Encode(user); err != nil {
 		http.Error(w, "", http.StatusInternalServerError)
@@ -309,13 +369,16 @@ func (a *API) getBalance(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func buildJWTString(login string, key string) (string, error) {
+func buildJWTString(c models.Credentials, key string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
 		models.Claims{
 			RegisteredClaims: jwt.RegisteredClaims{
 				ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExp)),
 			},
-			Login: login,
+			Login:   c.Login,
+			Role:    c.Role,
+			Scopes:  scope.SessionScopes(),
+			Version: c.TokenVersion,
 		})
 	tokenString, err := token.SignedString([]byte(key))
 	if err != nil {
@@ -352,7 +415,7 @@ func validByLuhnAlgo(orderNum string) error {
 	return nil
 }
 
-func checkOrderExists(ctx context.Context, s storage, newOrder string, newUser string) error {
+func checkOrderExists(ctx context.Context, s Storage, newOrder string, newUser string) error {
 	selectOrder, err := s.SelectOrder(ctx, newOrder)
 	if err != nil {
 		if !errors.Is(err, pgx.ErrNoRows) {
@@ -367,40 +430,29 @@ func checkOrderExists(ctx context.Context, s storage, newOrder string, newUser s
 	return ErrOrderBelongsAnotherUser
 }
 
-func hashPass(pass string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
-	if err != nil {
-		return "", fmt.Errorf("cannot generate hash: %w", err)
-	}
-	return string(hash), nil
-}
-
-func compareHash(dbHash string, reqPass string) error {
-	if err := bcrypt.CompareHashAndPassword([]byte(dbHash), []byte(reqPass)); err != nil {
-		return fmt.Errorf("cannot compare passwords: %w", err)
-	}
-	return nil
-}
-
 func proceedWithdraw(ctx context.Context, a *API, withdraw models.Withdraw) error {
 	order := models.Order{
 		ID:       withdraw.OrderNumber,
 		Username: withdraw.User,
 		Status:   status.NEW,
 	}
-	if err := a.storage.InsertOrder(ctx, order, a.log); err != nil {
+	if err := a.storage.InsertOrder(ctx, order); err != nil {
 		return fmt.Errorf("cannot insert order: %w", err)
 	}
 	u, err := a.storage.SelectUserBalance(ctx, withdraw.User)
 	if err != nil {
 		return fmt.Errorf("cannot select user: %w", err)
 	}
+	if u.Debt > 0 {
+		return models.ErrWithdrawalsBlocked
+	}
 	if u.Balance < withdraw.Sum {
 		return ErrInsufficientPoints
 	}
 
-	if err := a.storage.InsertWithdraw(ctx, withdraw, a.log); err != nil {
+	if err := a.storage.InsertWithdraw(ctx, withdraw); err != nil {
 		return fmt.Errorf("cannot insert withdraw: %w", err)
 	}
+	a.metrics.PointsWithdrawn(withdraw.Sum)
 	return nil
 }
@@ -1,9 +1,21 @@
 package v1
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/ospiem/gophermart/internal/config"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/role"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func Test_isValidByLuhnAlgo(t *testing.T) {
@@ -52,3 +64,92 @@ func Test_isValidByLuhnAlgo(t *testing.T) {
 		})
 	}
 }
+
+// newTestRouter returns the API routes over s with a single hashing worker.
+func newTestRouter(t testing.TB, s Storage) http.Handler {
+	t.Helper()
+	cfg := &config.Config{LogLevel: "error", JWTSecretKey: "secret", HashWorkers: 1, HashQueueSize: 1,
+		ResetTokenTTL: time.Hour}
+	l := zerolog.Nop()
+	return New(cfg, s, nil, nil, &l).Router()
+}
+
+// testToken returns a session token of the user. The test storage must answer
+// SelectTokenVersion with 0.
+func testToken(t testing.TB, login string, r role.Role) string {
+	t.Helper()
+	token, err := buildJWTString(models.Credentials{Login: login, Role: r}, "secret")
+	require.NoError(t, err)
+	return token
+}
+
+type benchStorage struct {
+	Storage
+	hash string
+}
+
+func (s *benchStorage) SelectCreds(_ context.Context, login string) (models.Credentials, error) {
+	return models.Credentials{Login: login, Pass: s.hash}, nil
+}
+
+func (s *benchStorage) SelectTokenVersion(_ context.Context, _ string) (int, error) {
+	return 0, nil
+}
+
+func (s *benchStorage) SelectUserBalance(_ context.Context, _ string) (models.UserBalance, error) {
+	return models.UserBalance{Balance: 100}, nil
+}
+
+// BenchmarkGetBalance measures getBalance latency with and without a
+// concurrent login flood competing for CPU.
+func BenchmarkGetBalance(b *testing.B) {
+	const floodWorkers = 64
+	pass := "qwerty"
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	require.NoError(b, err)
+
+	cfg := &config.Config{LogLevel: "error", JWTSecretKey: "secret", HashWorkers: 1, HashQueueSize: floodWorkers / 4}
+	l := zerolog.Nop()
+	a := New(cfg, &benchStorage{hash: string(hash)}, nil, nil, &l)
+	r := a.Router()
+
+	token, err := buildJWTString(models.Credentials{Login: "user", Role: role.User}, cfg.JWTSecretKey)
+	require.NoError(b, err)
+	loginBody := `{"login":"user","password":"` + pass + `"}`
+
+	getBalance := func(b *testing.B) {
+		b.Helper()
+		for i := 0; i < b.N; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/balance/", http.NoBody)
+			req.Header.Set(authorization, token)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				b.Fatalf("unexpected status %d", rec.Code)
+			}
+		}
+	}
+
+	b.Run("idle", getBalance)
+
+	b.Run("login flood", func(b *testing.B) {
+		ctx, cancel := context.WithCancel(context.Background())
+		wg := &sync.WaitGroup{}
+		for i := 0; i < floodWorkers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for ctx.Err() == nil {
+					req := httptest.NewRequest(http.MethodPost, "/api/user/login", strings.NewReader(loginBody))
+					req.Header.Set(contentType, applicationJSON)
+					r.ServeHTTP(httptest.NewRecorder(), req)
+				}
+			}()
+		}
+		b.ResetTimer()
+		getBalance(b)
+		b.StopTimer()
+		cancel()
+		wg.Wait()
+	})
+}
@@ -0,0 +1,148 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/hold"
+	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/auth"
+	"github.com/rs/zerolog"
+)
+
+const holdNotFound = "Active hold not found"
+const orderNumberInUse = "Order number is already in use"
+
+func (a *API) createHold(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "createHold").Logger()
+	if r.Header.Get(contentType) != applicationJSON {
+		http.Error(w, invalitContentTypeNotJSON, http.StatusBadRequest)
+		logger.Debug().Msg(invalidContentType)
+		return
+	}
+	ctx := r.Context()
+
+	login, ok := ctx.Value(auth.ContextLoginKey).(string)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	withdraw := models.Withdraw{}
+	if err := json.NewDecoder(r.Body).Decode(&withdraw); err != nil || withdraw.Sum <= 0 {
+		http.Error(w, invalidBody, http.StatusBadRequest)
+		return
+	}
+	if err := validByLuhnAlgo(withdraw.OrderNumber); err != nil {
+		http.Error(w, "Invalid order number", http.StatusUnprocessableEntity)
+		logger.Debug().Err(err).Msg("")
+		return
+	}
+
+	if a.needsApproval(withdraw.Sum) {
+		a.placeHold(w, r, logger, a.pendingHold(login, withdraw.OrderNumber, withdraw.Sum), http.StatusAccepted)
+		return
+	}
+	a.placeHold(w, r, logger, models.Hold{
+		Username:    login,
+		OrderNumber: withdraw.OrderNumber,
+		Sum:         withdraw.Sum,
+		TTL:         a.config().HoldTTL,
+	}, http.StatusCreated)
+}
+
+// placeHold creates the hold and responds with it and the given status code.
+func (a *API) placeHold(w http.ResponseWriter, r *http.Request, logger zerolog.Logger, h models.Hold, code int) {
+	h, err := a.storage.CreateHold(r.Context(), h)
+	if err != nil {
+		if errors.Is(err, models.ErrInsufficientBalance) {
+			http.Error(w, "Insufficient points", http.StatusPaymentRequired)
+			return
+		}
+		if errors.Is(err, models.ErrWithdrawalsBlocked) {
+			http.Error(w, "Withdrawals are blocked until reversed points are repaid", http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, models.ErrOrderOfAnotherUser) {
+			http.Error(w, "Order number belongs to another user", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, models.ErrOrderInUse) {
+			http.Error(w, orderNumberInUse, http.StatusUnprocessableEntity)
+			return
+		}
+		if writeLimitViolation(w, err, logger) {
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot create hold")
+		return
+	}
+
+	w.Header().Set(contentType, applicationJSON)
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(h); err != nil {
+		logger.Error().Err(err).Msg("cannot encode hold")
+	}
+}
+
+func (a *API) confirmHold(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "confirmHold").Logger()
+	a.resolveHold(w, r, logger, a.storage.ConfirmHold)
+}
+
+func (a *API) cancelHold(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "cancelHold").Logger()
+	a.resolveHold(w, r, logger, a.storage.CancelHold)
+}
+
+func (a *API) resolveHold(w http.ResponseWriter, r *http.Request, logger zerolog.Logger,
+	resolve func(ctx context.Context, login string, id string) (models.Hold, error)) {
+	ctx := r.Context()
+	login, ok := ctx.Value(auth.ContextLoginKey).(string)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	h, err := resolve(ctx, login, chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, holdNotFound, http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, models.ErrOrderInUse) {
+			http.Error(w, orderNumberInUse, http.StatusConflict)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot resolve hold")
+		return
+	}
+	if h.Status == hold.CONFIRMED {
+		a.metrics.PointsWithdrawn(h.Sum)
+	}
+	encodeJSON(w, h, logger)
+}
+
+func (a *API) getHolds(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "getHolds").Logger()
+	ctx := r.Context()
+
+	login, ok := ctx.Value(auth.ContextLoginKey).(string)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+	holds, err := a.storage.SelectHolds(ctx, login)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot get holds")
+		return
+	}
+	encodeJSON(w, holds, logger)
+}
@@ -0,0 +1,91 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ospiem/gophermart/internal/config"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/hold"
+	"github.com/ospiem/gophermart/internal/models/role"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type holdStorage struct {
+	Storage
+	err     error
+	created models.Hold
+}
+
+func (s *holdStorage) SelectTokenVersion(context.Context, string) (int, error) {
+	return 0, nil
+}
+
+func (s *holdStorage) CreateHold(_ context.Context, h models.Hold) (models.Hold, error) {
+	s.created = h
+	return h, s.err
+}
+
+func (s *holdStorage) ConfirmHold(context.Context, string, string) (models.Hold, error) {
+	return models.Hold{}, s.err
+}
+
+func TestHoldOrderNumberInUse(t *testing.T) {
+	tests := []struct {
+		err      error
+		name     string
+		path     string
+		wantCode int
+	}{
+		{name: "create", path: "/api/user/balance/holds/", wantCode: http.StatusCreated},
+		{name: "create with another user's order", path: "/api/user/balance/holds/",
+			err: models.ErrOrderOfAnotherUser, wantCode: http.StatusConflict},
+		{name: "create with own order", path: "/api/user/balance/holds/",
+			err: models.ErrOrderInUse, wantCode: http.StatusUnprocessableEntity},
+		{name: "confirm after the order was taken", path: "/api/user/balance/holds/h1/confirm",
+			err: models.ErrOrderInUse, wantCode: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path,
+				strings.NewReader(`{"order":"79927398713","sum":10}`))
+			req.Header.Set(contentType, applicationJSON)
+			req.Header.Set(authorization, testToken(t, "bob", role.User))
+			rec := httptest.NewRecorder()
+			newTestRouter(t, &holdStorage{err: tt.err}).ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantCode, rec.Code)
+		})
+	}
+}
+
+func TestHoldTTL(t *testing.T) {
+	cfg := &config.Config{LogLevel: "error", JWTSecretKey: "secret", HashWorkers: 1, HashQueueSize: 1,
+		HoldTTL: 15 * time.Minute, ApprovalThreshold: 100, ApprovalTTL: 72 * time.Hour}
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus string
+		wantTTL    time.Duration
+	}{
+		{name: "hold", body: `{"order":"79927398713","sum":10}`, wantTTL: cfg.HoldTTL},
+		{name: "withdrawal pending approval", body: `{"order":"79927398713","sum":100}`,
+			wantStatus: hold.PENDING, wantTTL: cfg.ApprovalTTL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &holdStorage{}
+			l := zerolog.Nop()
+			req := httptest.NewRequest(http.MethodPost, "/api/user/balance/holds/", strings.NewReader(tt.body))
+			req.Header.Set(contentType, applicationJSON)
+			req.Header.Set(authorization, testToken(t, "bob", role.User))
+			New(cfg, s, nil, nil, &l).Router().ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tt.wantStatus, s.created.Status)
+			assert.Equal(t, tt.wantTTL, s.created.TTL, "the storage computes the expiry from the TTL")
+		})
+	}
+}
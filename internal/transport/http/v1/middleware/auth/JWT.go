@@ -7,38 +7,111 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/role"
+	"github.com/ospiem/gophermart/internal/models/scope"
+	"github.com/rs/zerolog"
 )
 
 type ContextKey string
 
 const ContextLoginKey ContextKey = "login"
+const ContextScopesKey ContextKey = "scopes"
+const ContextRoleKey ContextKey = "role"
 
-func JWTAuthorization(key string) func(next http.Handler) http.Handler {
+type Storage interface {
+	SelectTokenVersion(ctx context.Context, login string) (int, error)
+	SelectAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, error)
+	TouchAPIKey(ctx context.Context, id string) error
+}
+
+// JWTAuthorization authenticates requests by a JWT in the Authorization header
+// or by an API key in the X-API-Key header.
+func JWTAuthorization(key string, s Storage) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			login, err := getUserLogin(r.Header.Get("Authorization"), key)
+			if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" {
+				k, err := authenticateAPIKey(r.Context(), apiKey, s)
+				if err != nil {
+					http.Error(w, "", http.StatusUnauthorized)
+					return
+				}
+				// API keys never act with more than user privileges.
+				next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), k.Username, role.User, k.Scopes)))
+				return
+			}
+
+			claims, err := getClaims(r.Header.Get("Authorization"), key)
 			if err != nil {
 				http.Error(w, "", http.StatusUnauthorized)
+				return
 			}
+			login := claims.Login
 
-			ctx := context.WithValue(r.Context(), ContextLoginKey, login)
-			r = r.WithContext(ctx)
+			// Tokens issued before the last password or role change are no longer valid.
+			version, err := s.SelectTokenVersion(r.Context(), login)
+			if err != nil || version != claims.Version {
+				http.Error(w, "", http.StatusUnauthorized)
+				return
+			}
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), login, claims.Role, claims.Scopes)))
 		})
 	}
 }
 
-func getUserLogin(tokenString string, key string) (string, error) {
+// RequireScope rejects requests whose credentials do not carry the scope.
+func RequireScope(sc scope.Scope) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, _ := r.Context().Value(ContextScopesKey).([]string)
+			for _, s := range scopes {
+				if s == sc {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "", http.StatusForbidden)
+		})
+	}
+}
+
+// RequireRole rejects requests from users that hold none of the roles.
+func RequireRole(roles ...role.Role) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userRole, _ := r.Context().Value(ContextRoleKey).(string)
+			for _, rl := range roles {
+				if rl == userRole {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "", http.StatusForbidden)
+		})
+	}
+}
+
+func withIdentity(ctx context.Context, login string, r role.Role, scopes []string) context.Context {
+	// The request logger is updated in place, so that the request line logged
+	// by the logger middleware carries the login too.
+	zerolog.Ctx(ctx).UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("login", login)
+	})
+	ctx = context.WithValue(ctx, ContextLoginKey, login)
+	ctx = context.WithValue(ctx, ContextRoleKey, r)
+	return context.WithValue(ctx, ContextScopesKey, scopes)
+}
+
+func getClaims(tokenString string, key string) (*models.Claims, error) {
 	claims := &models.Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
 		return []byte(key), nil
 	})
 	if err != nil {
-		return "", fmt.Errorf("cannot parse claims: %w", err)
+		return nil, fmt.Errorf("cannot parse claims: %w", err)
 	}
 	if !token.Valid {
-		return "", fmt.Errorf("token invalid")
+		return nil, fmt.Errorf("token invalid")
 	}
-	return claims.Login, nil
+	return claims, nil
 }
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ospiem/gophermart/internal/models/role"
+	"github.com/ospiem/gophermart/internal/models/scope"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireRoleAndScope(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	testCases := []struct {
+		name       string
+		middleware func(http.Handler) http.Handler
+		role       string
+		scopes     []string
+		wantStatus int
+	}{
+		{name: "admin passes", middleware: RequireRole(role.Admin), role: role.Admin,
+			wantStatus: http.StatusOK},
+		{name: "user rejected", middleware: RequireRole(role.Admin), role: role.User,
+			wantStatus: http.StatusForbidden},
+		{name: "no role rejected", middleware: RequireRole(role.Admin),
+			wantStatus: http.StatusForbidden},
+		{name: "scope granted", middleware: RequireScope(scope.OrdersRead), scopes: []string{scope.OrdersRead},
+			wantStatus: http.StatusOK},
+		{name: "scope missing", middleware: RequireScope(scope.Session), scopes: []string{scope.OrdersRead},
+			wantStatus: http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			if tc.role != "" || tc.scopes != nil {
+				req = req.WithContext(withIdentity(context.Background(), "user", tc.role, tc.scopes))
+			}
+			rec := httptest.NewRecorder()
+			tc.middleware(ok).ServeHTTP(rec, req)
+			assert.Equal(t, tc.wantStatus, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ospiem/gophermart/internal/apikey"
+	"github.com/ospiem/gophermart/internal/models"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+var errInvalidAPIKey = errors.New("invalid api key")
+
+func authenticateAPIKey(ctx context.Context, key string, s Storage) (models.APIKey, error) {
+	prefix, err := apikey.Prefix(key)
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("cannot parse api key: %w", err)
+	}
+	k, err := s.SelectAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("cannot get api key: %w", err)
+	}
+	if !apikey.Verify(key, k.Hash) {
+		return models.APIKey{}, errInvalidAPIKey
+	}
+	if err := s.TouchAPIKey(ctx, k.ID); err != nil {
+		return models.APIKey{}, fmt.Errorf("cannot touch api key: %w", err)
+	}
+	return k, nil
+}
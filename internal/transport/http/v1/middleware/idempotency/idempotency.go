@@ -0,0 +1,140 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/auth"
+	"github.com/rs/zerolog"
+)
+
+const Header = "Idempotency-Key"
+const ReplayedHeader = "Idempotent-Replayed"
+const maxKeyLength = 255
+
+type Storage interface {
+	ReserveIdempotencyKey(ctx context.Context, res models.IdempotentResponse) (models.IdempotentResponse, bool, error)
+	SaveIdempotentResponse(ctx context.Context, res models.IdempotentResponse) error
+	DeleteIdempotencyKey(ctx context.Context, login string, key string) error
+}
+
+// Middleware stores the first response to a request carrying an Idempotency-Key
+// for ttl and replays it to retries from the same user. A retry with the same
+// key but a different request gets 422. Server errors, panics and responses
+// that cannot be stored release the key, so that the request can be retried.
+// It must run after authorization.
+func Middleware(s Storage, ttl time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(Header)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			logger := zerolog.Ctx(r.Context()).With().Str("middleware", "idempotency").Logger()
+
+			login, ok := r.Context().Value(auth.ContextLoginKey).(string)
+			if !ok {
+				http.Error(w, "", http.StatusUnauthorized)
+				return
+			}
+			if len(key) > maxKeyLength {
+				http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			ctx := r.Context()
+			stored, reserved, err := s.ReserveIdempotencyKey(ctx, models.IdempotentResponse{
+				Username:    login,
+				Key:         key,
+				RequestHash: requestHash(r, body),
+				TTL:         ttl,
+			})
+			if err != nil {
+				http.Error(w, "", http.StatusInternalServerError)
+				logger.Error().Err(err).Msg("cannot reserve idempotency key")
+				return
+			}
+			if !reserved {
+				replay(w, r, stored, body)
+				return
+			}
+
+			// The request must complete its bookkeeping even if the client has gone.
+			ctx = context.WithoutCancel(ctx)
+			// Unless a response is stored, the key is released so that retries are
+			// not answered with 409 until it expires. Being deferred, the release
+			// also runs while a handler panic unwinds to the recoverer.
+			saved := false
+			defer func() {
+				if saved {
+					return
+				}
+				if err := s.DeleteIdempotencyKey(ctx, login, key); err != nil {
+					logger.Error().Err(err).Msg("cannot release idempotency key")
+				}
+			}()
+
+			buf := &bytes.Buffer{}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(buf)
+			next.ServeHTTP(ww, r)
+
+			if ww.Status() >= http.StatusInternalServerError {
+				return
+			}
+			// A handler that writes nothing responds with 200. A zero status would
+			// leave the key looking in progress forever.
+			stored.StatusCode = ww.Status()
+			if stored.StatusCode == 0 {
+				stored.StatusCode = http.StatusOK
+			}
+			stored.ContentType = ww.Header().Get("Content-Type")
+			stored.Body = buf.Bytes()
+			if err := s.SaveIdempotentResponse(ctx, stored); err != nil {
+				logger.Error().Err(err).Msg("cannot save idempotent response")
+				return
+			}
+			saved = true
+		})
+	}
+}
+
+func replay(w http.ResponseWriter, r *http.Request, stored models.IdempotentResponse, body []byte) {
+	if stored.RequestHash != requestHash(r, body) {
+		http.Error(w, "Idempotency-Key was used with a different request", http.StatusUnprocessableEntity)
+		return
+	}
+	if stored.StatusCode == 0 {
+		http.Error(w, "A request with this Idempotency-Key is in progress", http.StatusConflict)
+		return
+	}
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(stored.StatusCode)
+	_, _ = w.Write(stored.Body)
+}
+
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte(r.URL.Path))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,129 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+type memStorage struct {
+	responses map[string]models.IdempotentResponse
+	saveErr   error
+	mu        sync.Mutex
+}
+
+func (m *memStorage) ReserveIdempotencyKey(_ context.Context,
+	res models.IdempotentResponse) (models.IdempotentResponse, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stored, ok := m.responses[res.Username+res.Key]; ok {
+		return stored, false, nil
+	}
+	m.responses[res.Username+res.Key] = res
+	return res, true, nil
+}
+
+func (m *memStorage) SaveIdempotentResponse(_ context.Context, res models.IdempotentResponse) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	m.responses[res.Username+res.Key] = res
+	return nil
+}
+
+func (m *memStorage) DeleteIdempotencyKey(_ context.Context, login string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.responses, login+key)
+	return nil
+}
+
+func TestMiddleware(t *testing.T) {
+	calls := 0
+	status := http.StatusOK
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if status == 0 {
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("done"))
+	})
+	h := Middleware(&memStorage{responses: map[string]models.IdempotentResponse{}}, time.Hour)(next)
+
+	do := func(key string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(body))
+		req.Header.Set(Header, key)
+		req = req.WithContext(context.WithValue(req.Context(), auth.ContextLoginKey, "user"))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := do("k1", `{"order":"1"}`)
+	assert.Equal(t, http.StatusOK, first.Code)
+
+	retry := do("k1", `{"order":"1"}`)
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, "done", retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get(ReplayedHeader))
+	assert.Equal(t, 1, calls)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, do("k1", `{"order":"2"}`).Code)
+
+	status = http.StatusInternalServerError
+	do("k2", `{}`)
+	status = http.StatusOK
+	assert.Equal(t, http.StatusOK, do("k2", `{}`).Code)
+	assert.Equal(t, 3, calls)
+
+	status = 0
+	assert.Equal(t, http.StatusOK, do("k3", `{}`).Code)
+	retry = do("k3", `{}`)
+	assert.Equal(t, http.StatusOK, retry.Code, "a response without a status must not stay in progress")
+	assert.Equal(t, "true", retry.Header().Get(ReplayedHeader))
+	assert.Equal(t, 4, calls)
+}
+
+func TestMiddlewareReleasesUnsavedKeys(t *testing.T) {
+	tests := []struct {
+		next      http.HandlerFunc
+		saveErr   error
+		name      string
+		wantPanic bool
+	}{
+		{name: "handler panics", next: func(http.ResponseWriter, *http.Request) { panic("boom") },
+			wantPanic: true},
+		{name: "response cannot be saved", next: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}, saveErr: errors.New("connection lost")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &memStorage{responses: map[string]models.IdempotentResponse{}, saveErr: tt.saveErr}
+			h := Middleware(s, time.Hour)(tt.next)
+			req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(`{}`))
+			req.Header.Set(Header, "k1")
+			req = req.WithContext(context.WithValue(req.Context(), auth.ContextLoginKey, "user"))
+
+			var recovered any
+			func() {
+				defer func() { recovered = recover() }()
+				h.ServeHTTP(httptest.NewRecorder(), req)
+			}()
+			assert.Equal(t, tt.wantPanic, recovered != nil, "a panic must reach the recoverer")
+			assert.Empty(t, s.responses, "the key must be released for a retry")
+		})
+	}
+}
@@ -4,11 +4,16 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/ospiem/gophermart/internal/tracing"
+	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/requestid"
 	"github.com/rs/zerolog"
 
 	"github.com/go-chi/chi/v5/middleware"
 )
 
+// RequestLogger puts a logger carrying the request and trace IDs into the
+// request context, see zerolog.Ctx, and logs every request with it. It must run
+// after the request ID and tracing middlewares.
 func RequestLogger(log zerolog.Logger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -16,10 +21,14 @@ func RequestLogger(log zerolog.Logger) func(next http.Handler) http.Handler {
 			uri := r.RequestURI
 			method := r.Method
 
+			ctx := r.Context()
+			ctx = tracing.WithIDs(ctx, log.With().Str("request_id", requestid.FromContext(ctx))).Logger().WithContext(ctx)
+			// Log with the very logger in the context, which handlers may update.
+			l := zerolog.Ctx(ctx)
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 
 			defer func() {
-				log.Info().
+				l.Info().
 					Str("URI", uri).
 					Str("Method", method).
 					Str("Duration", time.Since(start).String()).
@@ -28,7 +37,7 @@ func RequestLogger(log zerolog.Logger) func(next http.Handler) http.Handler {
 					Msg("")
 			}()
 
-			next.ServeHTTP(ww, r)
+			next.ServeHTTP(ww, r.WithContext(ctx))
 		})
 	}
 }
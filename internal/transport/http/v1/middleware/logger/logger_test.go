@@ -0,0 +1,35 @@
+package logger
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/requestid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLoggerCorrelatesLines(t *testing.T) {
+	var buf bytes.Buffer
+	h := requestid.Middleware(RequestLogger(zerolog.New(&buf))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l := zerolog.Ctx(r.Context())
+			l.UpdateContext(func(c zerolog.Context) zerolog.Context { return c.Str("login", "alice") })
+			l.Info().Msg("handler line")
+		})))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(requestid.Header, "req-1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		assert.Contains(t, line, `"request_id":"req-1"`)
+		assert.Contains(t, line, `"login":"alice"`)
+	}
+}
@@ -0,0 +1,57 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+type ContextKey string
+
+const ContextRequestIDKey ContextKey = "requestID"
+
+const Header = "X-Request-ID"
+const maxLength = 128
+
+// Middleware takes the request ID from the X-Request-ID header, or generates
+// one if the header is missing or malformed, stores it in the request context
+// and echoes it in the response.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = generate()
+		}
+		w.Header().Set(Header, id)
+		ctx := context.WithValue(r.Context(), ContextRequestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// FromContext returns the request ID stored by Middleware, or an empty string.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ContextRequestIDKey).(string)
+	return id
+}
+
+// valid accepts IDs of printable ASCII characters only, so that a client cannot
+// smuggle anything odd into the logs or the response headers.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func generate() string {
+	b := make([]byte, 16)
+	// crypto/rand.Read does not fail on the supported platforms.
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,46 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	testCases := []struct {
+		name     string
+		header   string
+		wantSame bool
+	}{
+		{name: "accepted", header: "req-42", wantSame: true},
+		{name: "missing"},
+		{name: "too long", header: strings.Repeat("a", maxLength+1)},
+		{name: "control characters", header: "req\n42"},
+		{name: "spaces", header: "req 42"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got string
+			h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = FromContext(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				req.Header.Set(Header, tc.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.NotEmpty(t, got)
+			assert.Equal(t, got, rec.Header().Get(Header))
+			if tc.wantSame {
+				assert.Equal(t, tc.header, got)
+			} else {
+				assert.NotEqual(t, tc.header, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package v1
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/hasher"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/auth"
+	"github.com/rs/zerolog"
+)
+
+const resetTokenBytes = 32
+
+func (a *API) changePassword(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "changePassword").Logger()
+
+	if r.Header.Get(contentType) != applicationJSON {
+		http.Error(w, invalitContentTypeNotJSON, http.StatusBadRequest)
+		logger.Debug().Msg(invalidContentType)
+		return
+	}
+
+	ctx := r.Context()
+	login, ok := ctx.Value(auth.ContextLoginKey).(string)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	change := models.PasswordChange{}
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		http.Error(w, invalidBody, http.StatusBadRequest)
+		return
+	}
+	if change.OldPass == "" || change.NewPass == "" {
+		http.Error(w, invalidBody, http.StatusBadRequest)
+		return
+	}
+
+	dbCreds, err := a.storage.SelectCreds(ctx, login)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg(cannotGetUser)
+		return
+	}
+	if err := a.hasher.Compare(ctx, dbCreds.Pass, change.OldPass); err != nil {
+		if errors.Is(err, hasher.ErrQueueFull) {
+			http.Error(w, serviceBusy, http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, "Wrong password", http.StatusForbidden)
+		return
+	}
+
+	hash, err := a.hasher.Hash(ctx, change.NewPass)
+	if err != nil {
+		if errors.Is(err, hasher.ErrQueueFull) {
+			http.Error(w, serviceBusy, http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot hash password")
+		return
+	}
+
+	creds, err := a.storage.UpdatePassword(ctx, login, hash)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot update password")
+		return
+	}
+
+	token, err := buildJWTString(creds, a.config().JWTSecretKey)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot build token string")
+		return
+	}
+
+	w.Header().Set(authorization, token)
+	w.WriteHeader(http.StatusOK)
+}
+
+// requestPasswordReset always answers 202 so that it cannot be used to find out which logins exist.
+func (a *API) requestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "requestPasswordReset").Logger()
+
+	if r.Header.Get(contentType) != applicationJSON {
+		http.Error(w, invalitContentTypeNotJSON, http.StatusBadRequest)
+		logger.Debug().Msg(invalidContentType)
+		return
+	}
+
+	ctx := r.Context()
+	req := models.PasswordResetRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Login == "" {
+		http.Error(w, invalidBody, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := a.storage.SelectCreds(ctx, req.Login); err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "", http.StatusInternalServerError)
+			logger.Error().Err(err).Msg(cannotGetUser)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	token, err := generateResetToken()
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot generate reset token")
+		return
+	}
+	ttl := a.config().ResetTokenTTL
+	if err := a.storage.InsertResetToken(ctx, req.Login, hashResetToken(token), ttl); err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot insert reset token")
+		return
+	}
+	if err := a.notifier.SendResetToken(ctx, req.Login, token, time.Now().Add(ttl)); err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot send reset token")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *API) confirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "confirmPasswordReset").Logger()
+
+	if r.Header.Get(contentType) != applicationJSON {
+		http.Error(w, invalitContentTypeNotJSON, http.StatusBadRequest)
+		logger.Debug().Msg(invalidContentType)
+		return
+	}
+
+	ctx := r.Context()
+	req := models.PasswordResetConfirm{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, invalidBody, http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" || req.NewPass == "" {
+		http.Error(w, invalidBody, http.StatusBadRequest)
+		return
+	}
+
+	hash, err := a.hasher.Hash(ctx, req.NewPass)
+	if err != nil {
+		if errors.Is(err, hasher.ErrQueueFull) {
+			http.Error(w, serviceBusy, http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot hash password")
+		return
+	}
+
+	creds, err := a.storage.ResetPassword(ctx, hashResetToken(req.Token), hash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, models.ErrUserBlocked) {
+			http.Error(w, "Account is blocked", http.StatusForbidden)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot reset password")
+		return
+	}
+
+	token, err := buildJWTString(creds, a.config().JWTSecretKey)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot build token string")
+		return
+	}
+
+	w.Header().Set(authorization, token)
+	w.WriteHeader(http.StatusOK)
+}
+
+func generateResetToken() (string, error) {
+	b := make([]byte, resetTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("cannot read random bytes: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashResetToken hashes a reset token for storage. Tokens carry enough entropy
+// that a plain SHA-256 is sufficient and keeps lookups by hash possible.
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,87 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/role"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type passwordStorage struct {
+	Storage
+	hash     string
+	updated  bool
+	resetErr error
+}
+
+func (s *passwordStorage) SelectCreds(_ context.Context, login string) (models.Credentials, error) {
+	return models.Credentials{Login: login, Pass: s.hash}, nil
+}
+
+func (s *passwordStorage) SelectTokenVersion(context.Context, string) (int, error) {
+	return 0, nil
+}
+
+func (s *passwordStorage) UpdatePassword(_ context.Context, login string, _ string) (models.Credentials, error) {
+	s.updated = true
+	return models.Credentials{Login: login, TokenVersion: 1}, nil
+}
+
+func (s *passwordStorage) ResetPassword(context.Context, string, string) (models.Credentials, error) {
+	if s.resetErr != nil {
+		return models.Credentials{}, s.resetErr
+	}
+	return models.Credentials{Login: "user", TokenVersion: 1}, nil
+}
+
+func TestPasswordHandlers(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("current"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	tests := []struct {
+		resetErr    error
+		name        string
+		path        string
+		body        string
+		wantCode    int
+		wantUpdated bool
+	}{
+		{name: "change", path: "/api/user/password", body: `{"old_password":"current","new_password":"next"}`,
+			wantCode: http.StatusOK, wantUpdated: true},
+		{name: "change with wrong current password", path: "/api/user/password",
+			body: `{"old_password":"wrong","new_password":"next"}`, wantCode: http.StatusForbidden},
+		{name: "change without new password", path: "/api/user/password", body: `{"old_password":"current"}`,
+			wantCode: http.StatusBadRequest},
+		{name: "reset", path: "/api/user/password/reset/confirm", body: `{"token":"t","new_password":"next"}`,
+			wantCode: http.StatusOK},
+		{name: "reset with used or expired token", path: "/api/user/password/reset/confirm",
+			body: `{"token":"t","new_password":"next"}`, resetErr: pgx.ErrNoRows, wantCode: http.StatusBadRequest},
+		{name: "reset of a blocked account", path: "/api/user/password/reset/confirm",
+			body: `{"token":"t","new_password":"next"}`, resetErr: models.ErrUserBlocked,
+			wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &passwordStorage{hash: string(hash), resetErr: tt.resetErr}
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(contentType, applicationJSON)
+			req.Header.Set(authorization, testToken(t, "user", role.User))
+			rec := httptest.NewRecorder()
+			newTestRouter(t, s).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Equal(t, tt.wantUpdated, s.updated)
+			if tt.wantCode == http.StatusOK {
+				assert.NotEmpty(t, rec.Header().Get(authorization), "a new token must be issued")
+			}
+		})
+	}
+}
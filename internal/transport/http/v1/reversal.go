@@ -0,0 +1,66 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/auth"
+	"github.com/rs/zerolog"
+)
+
+// reverseOrder lets a merchant holding the owner's API key reverse an order after a return.
+func (a *API) reverseOrder(w http.ResponseWriter, r *http.Request) {
+	login, ok := r.Context().Value(auth.ContextLoginKey).(string)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+	a.proceedReversal(w, r, models.Reversal{Username: login, Actor: login})
+}
+
+func (a *API) adminReverseOrder(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value(auth.ContextLoginKey).(string)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+	a.proceedReversal(w, r, models.Reversal{Actor: admin, ByAdmin: true})
+}
+
+func (a *API) proceedReversal(w http.ResponseWriter, r *http.Request, rev models.Reversal) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "proceedReversal").Logger()
+
+	if r.Header.Get(contentType) != applicationJSON {
+		http.Error(w, invalitContentTypeNotJSON, http.StatusBadRequest)
+		logger.Debug().Msg(invalidContentType)
+		return
+	}
+	body := models.AdminAction{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Reason == "" {
+		http.Error(w, "Reason is required", http.StatusBadRequest)
+		return
+	}
+	rev.OrderID = chi.URLParam(r, "id")
+	rev.Reason = body.Reason
+	rev.Policy = a.config().ReversalPolicy
+
+	rev, err := a.storage.ReverseOrder(r.Context(), rev)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, orderNotFound, http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, models.ErrOrderNotReversible) {
+			http.Error(w, "Only processed orders can be reversed", http.StatusConflict)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		logger.Error().Err(err).Msg("cannot reverse order")
+		return
+	}
+	encodeJSON(w, rev, logger)
+}
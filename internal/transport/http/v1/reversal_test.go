@@ -0,0 +1,57 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/models/role"
+	"github.com/stretchr/testify/assert"
+)
+
+type reversalStorage struct {
+	Storage
+	reversed []models.Reversal
+}
+
+func (s *reversalStorage) SelectTokenVersion(context.Context, string) (int, error) {
+	return 0, nil
+}
+
+func (s *reversalStorage) ReverseOrder(_ context.Context, rev models.Reversal) (models.Reversal, error) {
+	s.reversed = append(s.reversed, rev)
+	return rev, nil
+}
+
+func TestReverseOrderNeedsGrant(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		role         role.Role
+		wantCode     int
+		wantReversed bool
+	}{
+		{name: "user session", path: "/api/user/orders/79927398713/reverse", role: role.User,
+			wantCode: http.StatusForbidden},
+		{name: "admin session on the user API", path: "/api/user/orders/79927398713/reverse", role: role.Admin,
+			wantCode: http.StatusForbidden},
+		{name: "admin API", path: "/api/admin/orders/79927398713/reverse", role: role.Admin,
+			wantCode: http.StatusOK, wantReversed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &reversalStorage{}
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{"reason":"returned"}`))
+			req.Header.Set(contentType, applicationJSON)
+			req.Header.Set(authorization, testToken(t, "bob", tt.role))
+			rec := httptest.NewRecorder()
+			newTestRouter(t, s).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Equal(t, tt.wantReversed, len(s.reversed) == 1)
+		})
+	}
+}
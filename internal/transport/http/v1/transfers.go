@@ -0,0 +1,62 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ospiem/gophermart/internal/models"
+	"github.com/ospiem/gophermart/internal/transport/http/v1/middleware/auth"
+	"github.com/rs/zerolog"
+)
+
+func (a *API) transferPoints(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).With().Str(handler, "transferPoints").Logger()
+	if r.Header.Get(contentType) != applicationJSON {
+		http.Error(w, invalitContentTypeNotJSON, http.StatusBadRequest)
+		logger.Debug().Msg(invalidContentType)
+		return
+	}
+	ctx := r.Context()
+
+	login, ok := ctx.Value(auth.ContextLoginKey).(string)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	t := models.Transfer{}
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil || t.To == "" || t.Sum <= 0 {
+		http.Error(w, invalidBody, http.StatusBadRequest)
+		return
+	}
+	t.From = login
+	if t.From == t.To {
+		http.Error(w, "Cannot transfer points to yourself", http.StatusBadRequest)
+		return
+	}
+
+	t, err := a.storage.Transfer(ctx, t, float32(a.config().TransferDailyLimit))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			http.Error(w, "Recipient not found", http.StatusNotFound)
+		case errors.Is(err, models.ErrInsufficientBalance):
+			http.Error(w, "Insufficient points", http.StatusPaymentRequired)
+		case errors.Is(err, models.ErrWithdrawalsBlocked):
+			http.Error(w, "Transfers are blocked until reversed points are repaid", http.StatusForbidden)
+		case errors.Is(err, models.ErrTransferLimitExceeded):
+			http.Error(w, "Daily transfer limit exceeded", http.StatusTooManyRequests)
+		default:
+			http.Error(w, "", http.StatusInternalServerError)
+			logger.Error().Err(err).Msg("cannot transfer points")
+		}
+		return
+	}
+
+	w.Header().Set(contentType, applicationJSON)
+	if err := json.NewEncoder(w).Encode(t); err != nil {
+		logger.Error().Err(err).Msg("cannot encode transfer")
+	}
+}
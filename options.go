@@ -0,0 +1,71 @@
+package gophermart
+
+import (
+	"net/http"
+
+	"github.com/rs/zerolog"
+)
+
+// Option customizes a Server built by New.
+type Option func(*options)
+
+type options struct {
+	cfg         *Config
+	logger      zerolog.Logger
+	storage     Storage
+	accrual     *http.Client
+	middlewares []func(http.Handler) http.Handler
+	mounts      []mount
+}
+
+type mount struct {
+	pattern string
+	handler http.Handler
+}
+
+// WithConfig sets the configuration. Without it, New loads the configuration
+// from the defaults, the CONFIG_FILE file and the environment.
+func WithConfig(cfg Config) Option {
+	return func(o *options) {
+		o.cfg = &cfg
+	}
+}
+
+// WithLogger sets the logger. Without it, the server logs nothing.
+func WithLogger(l zerolog.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithStorage sets the storage instead of the PostgreSQL database given by the
+// configuration, which then needs no database_uri.
+func WithStorage(s Storage) Option {
+	return func(o *options) {
+		o.storage = s
+	}
+}
+
+// WithAccrualClient sets the HTTP client that calls the accrual system. It
+// replaces the accrual TLS settings of the configuration.
+func WithAccrualClient(c *http.Client) Option {
+	return func(o *options) {
+		o.accrual = c
+	}
+}
+
+// WithMiddleware adds middlewares to the API. They run after the built-in
+// ones, so they see the request ID and the request logger.
+func WithMiddleware(mw ...func(http.Handler) http.Handler) Option {
+	return func(o *options) {
+		o.middlewares = append(o.middlewares, mw...)
+	}
+}
+
+// WithMount serves h under pattern next to the API. The pattern must not
+// clash with the API routes.
+func WithMount(pattern string, h http.Handler) Option {
+	return func(o *options) {
+		o.mounts = append(o.mounts, mount{pattern: pattern, handler: h})
+	}
+}
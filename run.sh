@@ -1,6 +1,6 @@
 #!/usr/bin/env bash
 
-  ./.tools/gophermarttest \
+  SECRET_KEY=autotests-secret ./.tools/gophermarttest \
             -test.v -test.run=^TestGophermart$ \
             -gophermart-binary-path=cmd/gophermart/gophermart \
             -gophermart-host=localhost \